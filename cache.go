@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Increment whenever the cache layout or the checksum algorithm changes
+const checksumCacheVersion = 2
+
+// checksumCacheID identifies a file on disk, independent of its path
+type checksumCacheID struct {
+	Dev uint64
+	Ino uint64
+}
+
+type checksumCacheEntry struct {
+	// Any change to these fields invalidates the entry
+	Size  int64
+	Mtime int64
+	Ctime int64
+
+	HasChecksum bool
+	Checksum    [ChecksumBlockSize]byte
+	HasPrehash  bool
+	Prehash     [ChecksumBlockSize]byte
+}
+
+// checksumCacheFile is the on-disk format of --cache
+type checksumCacheFile struct {
+	Version int
+
+	// Options that affect checksum values
+	Algorithm  string
+	HashKey    []byte
+	SkipHeader int64
+	SkipFooter int64
+
+	Entries map[checksumCacheID]*checksumCacheEntry
+}
+
+type checksumCache struct {
+	path  string
+	mutex sync.Mutex
+	file  checksumCacheFile
+	dirty bool
+}
+
+// loadChecksumCache reads the cache at path, or returns an empty cache if
+// path does not exist. An unreadable or incompatible cache is discarded
+// with a warning, as every entry can be regenerated.
+// On success, hashKey is replaced with the key the cache was created with.
+func loadChecksumCache(path string, o *options) *checksumCache {
+	c := &checksumCache{
+		path: path,
+	}
+
+	err := c.read(o)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("%s: discarding checksum cache: %s\n", path, err)
+		}
+		c.file = checksumCacheFile{
+			Version:    checksumCacheVersion,
+			Algorithm:  o.hashAlgorithm(),
+			HashKey:    hashKey,
+			SkipHeader: o.SkipHeader,
+			SkipFooter: o.SkipFooter,
+			Entries:    make(map[checksumCacheID]*checksumCacheEntry),
+		}
+		c.dirty = true
+		return c
+	}
+
+	hashKey = c.file.HashKey
+	return c
+}
+
+func (c *checksumCache) read(o *options) error {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = gob.NewDecoder(f).Decode(&c.file); err != nil {
+		return err
+	}
+
+	switch {
+	case c.file.Version != checksumCacheVersion:
+		return fmt.Errorf("unsupported version %d", c.file.Version)
+	case c.file.Algorithm != o.hashAlgorithm():
+		return fmt.Errorf("created with --hash %s", c.file.Algorithm)
+	case len(c.file.HashKey) != len(hashKey):
+		return errors.New("invalid hash key")
+	case c.file.SkipHeader != o.SkipHeader || c.file.SkipFooter != o.SkipFooter:
+		return errors.New("created with different --skip-header or --skip-footer")
+	case c.file.Entries == nil:
+		c.file.Entries = make(map[checksumCacheID]*checksumCacheEntry)
+	}
+	return nil
+}
+
+// Save writes the cache back to disk, if it has changed
+func (c *checksumCache) Save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(c.path), ".fdf-cache-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err = gob.NewEncoder(f).Encode(&c.file); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(f.Name(), c.path); err != nil {
+		return err
+	}
+
+	c.dirty = false
+	return nil
+}
+
+func cacheID(r *fileRecord) (id checksumCacheID, s statInfo, ok bool) {
+	if s, ok = getStatInfo(r.FileInfo); !ok {
+		return id, s, false
+	}
+	return checksumCacheID{Dev: s.Dev, Ino: s.Ino}, s, true
+}
+
+// Load populates the checksum and prehash of r from the cache, if a valid entry exists
+func (c *checksumCache) Load(r *fileRecord) {
+	id, s, ok := cacheID(r)
+	if !ok {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e, ok := c.file.Entries[id]
+	if !ok || e.Size != r.Size() || e.Mtime != r.ModTime().UnixNano() || e.Ctime != s.Ctime.UnixNano() {
+		return
+	}
+
+	if e.HasChecksum && !r.HasChecksum {
+		r.Checksum = checksum{size: e.Size, hash: e.Checksum}
+		r.HasChecksum = true
+	}
+	if e.HasPrehash && !r.HasPrehash {
+		r.Prehash = checksum{size: e.Size, hash: e.Prehash}
+		r.HasPrehash = true
+	}
+}
+
+// Store records the checksum and prehash of r, replacing any outdated entry
+func (c *checksumCache) Store(r *fileRecord) {
+	id, s, ok := cacheID(r)
+	if !ok {
+		return
+	}
+
+	e := &checksumCacheEntry{
+		Size:        r.Size(),
+		Mtime:       r.ModTime().UnixNano(),
+		Ctime:       s.Ctime.UnixNano(),
+		HasChecksum: r.HasChecksum,
+		Checksum:    r.Checksum.hash,
+		HasPrehash:  r.HasPrehash,
+		Prehash:     r.Prehash.hash,
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.file.Entries[id] = e
+	c.dirty = true
+}
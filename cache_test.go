@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksumCache(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "fdftest")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	cachePath := filepath.Join(dir, "cache")
+	filePath := filepath.Join(dir, "file")
+	assert.NoError(ioutil.WriteFile(filePath, []byte("foobar\n"), 0666))
+
+	record := func() *fileRecord {
+		st, err := os.Stat(filePath)
+		assert.NoError(err)
+		return newFileRecord(filePath, st, "file", "")
+	}
+
+	scanner := newScanner()
+	scanner.table.cache = loadChecksumCache(cachePath, &scanner.options)
+	r := record()
+	if _, ok := getStatInfo(r.FileInfo); !ok {
+		t.Skip("checksum cache is not supported on this platform")
+	}
+	assert.NoError(scanner.table.Checksum(r, false))
+	assert.NoError(scanner.table.cache.Save())
+
+	// A new run reuses the hash key and checksum
+	key := hashKey
+	hashKey = make([]byte, len(key))
+	scanner = newScanner()
+	scanner.table.cache = loadChecksumCache(cachePath, &scanner.options)
+	assert.Equal(key, hashKey)
+	cached := record()
+	scanner.table.cache.Load(cached)
+	assert.True(cached.HasChecksum)
+	assert.Equal(r.Checksum, cached.Checksum)
+
+	// Changing the mtime invalidates the entry
+	ts := time.Now().Add(-time.Hour)
+	assert.NoError(os.Chtimes(filePath, ts, ts))
+	changed := record()
+	scanner.table.cache.Load(changed)
+	assert.False(changed.HasChecksum)
+
+	// Changing checksum options invalidates the whole cache
+	scanner = newScanner()
+	scanner.options.SkipHeader = 1
+	scanner.table.cache = loadChecksumCache(cachePath, &scanner.options)
+	assert.Empty(scanner.table.cache.file.Entries)
+
+	// A corrupt cache is discarded
+	assert.NoError(ioutil.WriteFile(cachePath, []byte("garbage"), 0666))
+	scanner = newScanner()
+	scanner.table.cache = loadChecksumCache(cachePath, &scanner.options)
+	assert.Empty(scanner.table.cache.file.Entries)
+	assert.NoError(scanner.table.cache.Save())
+}
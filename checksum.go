@@ -2,31 +2,66 @@ package main
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"fmt"
+	"hash"
+	"hash/crc64"
 	"io"
+	"os"
 
 	"github.com/minio/highwayhash"
 )
 
-const ChecksumBlockSize = 16
+// Largest digest produced by any of hashAlgorithms.
+// Shorter digests are zero-padded.
+const ChecksumBlockSize = sha256.Size
 
 // 32 bytes of random hash key
 var hashKey []byte
 
+const (
+	HashHighway = "highwayhash"
+	HashSHA256  = "sha256"
+	HashCRC64   = "crc64"
+)
+
+type hashAlgorithm struct {
+	new func() (hash.Hash, error)
+
+	// Collisions are computationally infeasible, see --trust-hash
+	cryptographic bool
+
+	// Checksums depend on hashKey, and cannot be compared across runs
+	keyed bool
+}
+
+var crc64Table = crc64.MakeTable(crc64.ECMA)
+
+var hashAlgorithms = map[string]hashAlgorithm{
+	HashHighway: {new: func() (hash.Hash, error) { return highwayhash.New128(hashKey) }, keyed: true},
+	HashSHA256:  {new: func() (hash.Hash, error) { return sha256.New(), nil }, cryptographic: true},
+	HashCRC64:   {new: func() (hash.Hash, error) { return crc64.New(crc64Table), nil }},
+}
+
 func init() {
 	hashKey = make([]byte, 32)
 	rand.Read(hashKey)
 
-	h, err := highwayhash.New128(hashKey)
-	if err != nil {
-		panic(err)
-	}
+	for name, a := range hashAlgorithms {
+		h, err := a.new()
+		if err != nil {
+			panic(err)
+		}
 
-	if h.Size() != ChecksumBlockSize {
-		panic("unexpected block size")
+		if h.Size() > ChecksumBlockSize {
+			panic("unexpected block size for " + name)
+		}
 	}
 }
 
+// checksumStarted is called as Checksum begins reading each file, for tests
+var checksumStarted = func(r *fileRecord) {}
+
 // updateDB is false if the file being checksummed has not yet been added to the DB
 func (t *fileTable) Checksum(r *fileRecord, updateDB bool) error {
 	if r.HasChecksum {
@@ -37,7 +72,12 @@ func (t *fileTable) Checksum(r *fileRecord, updateDB bool) error {
 		return r.FailedChecksum
 	}
 
+	if t.loadCached(r, updateDB); r.HasChecksum {
+		return nil
+	}
+
 	t.progress(r.RelPath, false)
+	checksumStarted(r)
 
 	f, err := t.options.OpenFile(r.FilePath)
 	if err != nil {
@@ -48,7 +88,7 @@ func (t *fileTable) Checksum(r *fileRecord, updateDB bool) error {
 	}
 	defer f.Close()
 
-	b, err := hwhChecksum(f)
+	b, err := t.options.checksumReader(f)
 	if err != nil {
 		r.FailedChecksum = err
 		t.totals.Errors.Add(r)
@@ -60,6 +100,10 @@ func (t *fileTable) Checksum(r *fileRecord, updateDB bool) error {
 	copy(r.Checksum.hash[:], b)
 	r.HasChecksum = true
 
+	if t.cache != nil {
+		t.cache.Store(r)
+	}
+
 	if updateDB {
 		// Update indexes with new checksum
 		t.db.insert(r)
@@ -67,13 +111,99 @@ func (t *fileTable) Checksum(r *fileRecord, updateDB bool) error {
 	return nil
 }
 
+// loadCached populates r from the --cache file, if any
+func (t *fileTable) loadCached(r *fileRecord, updateDB bool) {
+	if t.cache == nil {
+		return
+	}
+
+	hadChecksum, hadPrehash := r.HasChecksum, r.HasPrehash
+	t.cache.Load(r)
+
+	if updateDB && (r.HasChecksum != hadChecksum || r.HasPrehash != hadPrehash) {
+		t.db.insert(r)
+	}
+}
+
+// Number of bytes hashed at each end of a file by Prehash
+const prehashBlockSize = 0x4000 // 16KB
+
+// usePrehash returns true if r is large enough that a Prehash saves reading the full file
+func (t *fileTable) usePrehash(r *fileRecord) bool {
+	return r.Size()-t.options.SkipHeader-t.options.SkipFooter > 4*prehashBlockSize
+}
+
+// Prehash hashes the first and last prehashBlockSize bytes of r, excluding any
+// skipped header or footer. Files with differing prehashes cannot be equal.
+// updateDB is false if the file being hashed has not yet been added to the DB
+func (t *fileTable) Prehash(r *fileRecord, updateDB bool) error {
+	if r.HasPrehash {
+		return nil
+	}
+
+	if r.FailedChecksum != nil {
+		return r.FailedChecksum
+	}
+
+	if t.loadCached(r, updateDB); r.HasPrehash {
+		return nil
+	}
+
+	b, err := t.prehash(r)
+	if err != nil {
+		r.FailedChecksum = err
+		t.totals.Errors.Add(r)
+		fmt.Printf("%s: %s\n", r.RelPath, err)
+		return err
+	}
+
+	r.Prehash.size = r.Size()
+	copy(r.Prehash.hash[:], b)
+	r.HasPrehash = true
+
+	if t.cache != nil {
+		t.cache.Store(r)
+	}
+
+	if updateDB {
+		t.db.insert(r)
+	}
+	return nil
+}
+
+func (t *fileTable) prehash(r *fileRecord) ([]byte, error) {
+	f, err := os.Open(r.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	end := r.Size() - t.options.SkipFooter
+	head := io.NewSectionReader(f, t.options.SkipHeader, prehashBlockSize)
+	tail := io.NewSectionReader(f, end-prehashBlockSize, prehashBlockSize)
+
+	return t.options.checksumReader(io.MultiReader(head, tail))
+}
+
+// checksumReader hashes r using the algorithm selected by --hash
+func (o *options) checksumReader(r io.Reader) ([]byte, error) {
+	h, err := hashAlgorithms[o.hashAlgorithm()].new()
+	if err != nil {
+		return nil, err
+	}
+	return sumReader(h, r)
+}
+
 func hwhChecksum(r io.Reader) ([]byte, error) {
 	h, err := highwayhash.New128(hashKey)
 	if err != nil {
 		return nil, err
 	}
+	return sumReader(h, r)
+}
 
-	_, err = io.Copy(h, r)
+func sumReader(h hash.Hash, r io.Reader) ([]byte, error) {
+	_, err := io.Copy(h, r)
 	if err != nil {
 		return nil, err
 	}
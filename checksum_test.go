@@ -2,7 +2,10 @@ package main
 
 import (
 	"bytes"
+	"io/ioutil"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/minio/highwayhash"
@@ -32,3 +35,72 @@ func BenchmarkChecksum_hwh(b *testing.B) {
 		hwhChecksum(bytes.NewReader(buf))
 	}
 }
+
+func TestChecksum_Prehash(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "fdftest")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	buf := make([]byte, 8*prehashBlockSize)
+	rand.Read(buf)
+
+	write := func(name string, offset int) *fileRecord {
+		b := append([]byte{}, buf...)
+		if offset >= 0 {
+			b[offset]++
+		}
+		p := filepath.Join(dir, name)
+		assert.NoError(ioutil.WriteFile(p, b, 0666))
+		st, err := os.Stat(p)
+		assert.NoError(err)
+		return newFileRecord(p, st, name, "")
+	}
+
+	original := write("original", -1)
+	differentHead := write("head", 0)
+	differentMiddle := write("middle", len(buf)/2)
+	differentTail := write("tail", len(buf)-1)
+
+	scanner := newScanner()
+	scanner.options.MatchMode = matchContent
+	assert.True(scanner.table.usePrehash(original))
+
+	candidates := recordSet{
+		differentHead:   {},
+		differentMiddle: {},
+		differentTail:   {},
+	}
+	filtered := scanner.table.prehashCandidates(original, candidates)
+	assert.Len(filtered, 1)
+	assert.Contains(filtered, differentMiddle)
+
+	// Only the middle of the file differs, so a full comparison is still required
+	assert.Nil(scanner.table.checkCandidates(original, candidates))
+	assert.True(differentMiddle.HasChecksum)
+	assert.False(differentHead.HasChecksum)
+	assert.False(differentTail.HasChecksum)
+}
+
+func TestChecksum_Algorithms(t *testing.T) {
+	assert := require.New(t)
+
+	sizes := map[string]int{
+		HashHighway: 16,
+		HashSHA256:  32,
+		HashCRC64:   8,
+	}
+	assert.Len(hashAlgorithms, len(sizes))
+
+	for name, size := range sizes {
+		o := &options{HashAlgorithm: name}
+		a, err := o.checksumReader(bytes.NewReader([]byte("foo\n")))
+		assert.NoError(err)
+		assert.Len(a, size, name)
+
+		b, err := o.checksumReader(bytes.NewReader([]byte("bar\n")))
+		assert.NoError(err)
+		assert.NotEqual(a, b, name)
+	}
+}
@@ -1,9 +1,16 @@
 package main
 
-// #include <sys/sendfile.h>
-import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
 
-import "os"
+	"golang.org/x/sys/unix"
+)
+
+// Maximum bytes requested per copy_file_range or sendfile call
+const copyChunkSize = 0x40000000 // 1GB
 
 func copyFile(src, dst string) error {
 	sf, err := os.Open(src)
@@ -23,9 +30,146 @@ func copyFile(src, dst string) error {
 	}
 	defer df.Close()
 
-	n, err := C.sendfile(C.int(df.Fd()), C.int(sf.Fd()), nil, C.ulong(st.Size()))
-	if n < 0 {
+	c := &rangeCopier{src: sf, dst: df}
+	if err = c.copySparse(st.Size()); err != nil {
+		return err
+	}
+	if c.written != c.data {
+		return fmt.Errorf("copied %d of %d bytes", c.written, c.data)
+	}
+
+	// A source that changed size mid-copy may have been copied only in part
+	after, err := sf.Stat()
+	if err != nil {
 		return err
 	}
+	if after.Size() != st.Size() {
+		return fmt.Errorf("size changed from %d to %d bytes during copy", st.Size(), after.Size())
+	}
+
+	// Restores any trailing hole
+	if err = df.Truncate(st.Size()); err != nil {
+		return err
+	}
+
+	return df.Close()
+}
+
+// rangeCopier copies byte ranges between files, preferring copy_file_range,
+// which creates reflinks on supporting filesystems, then sendfile, then read/write.
+type rangeCopier struct {
+	src *os.File
+	dst *os.File
+
+	noCopyFileRange bool
+	noSendfile      bool
+
+	// Bytes within the data segments of src, and bytes written to dst
+	data    int64
+	written int64
+
+	// Used by the read/write fallback
+	buf []byte
+}
+
+// copySparse copies the data segments of src, leaving holes unallocated in dst
+func (c *rangeCopier) copySparse(size int64) error {
+	fd := int(c.src.Fd())
+
+	for offset := int64(0); offset < size; {
+		data, err := unix.Seek(fd, offset, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			// Only a hole remains
+			return nil
+		}
+
+		hole := size
+		if err != nil {
+			// SEEK_DATA is not supported, treat the remainder as data
+			data = offset
+		} else if hole, err = unix.Seek(fd, data, unix.SEEK_HOLE); err != nil || hole > size {
+			hole = size
+		}
+
+		if data >= size {
+			return nil
+		}
+
+		c.data += hole - data
+		if err = c.copyRange(data, hole-data); err != nil {
+			return err
+		}
+		offset = hole
+	}
+
+	return nil
+}
+
+// copyRange copies length bytes at offset in src to the same offset in dst
+func (c *rangeCopier) copyRange(offset, length int64) error {
+	for length > 0 {
+		chunk := length
+		if chunk > copyChunkSize {
+			chunk = copyChunkSize
+		}
+
+		n, err := c.copyChunk(offset, int(chunk))
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("copy at offset %d: %w", offset, io.ErrUnexpectedEOF)
+		}
+
+		c.written += int64(n)
+		offset += int64(n)
+		length -= int64(n)
+	}
 	return nil
 }
+
+func (c *rangeCopier) copyChunk(offset int64, length int) (int, error) {
+	if !c.noCopyFileRange {
+		roff, woff := offset, offset
+		n, err := unix.CopyFileRange(int(c.src.Fd()), &roff, int(c.dst.Fd()), &woff, length, 0)
+		if !fallbackErr(err) {
+			return n, err
+		}
+		c.noCopyFileRange = true
+	}
+
+	if !c.noSendfile {
+		// sendfile writes at the current position of dst
+		if _, err := c.dst.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		roff := offset
+		n, err := unix.Sendfile(int(c.dst.Fd()), int(c.src.Fd()), &roff, length)
+		if !fallbackErr(err) {
+			return n, err
+		}
+		c.noSendfile = true
+	}
+
+	if c.buf == nil {
+		c.buf = make([]byte, fileBufferSize)
+	}
+	buf := c.buf
+	if length < len(buf) {
+		buf = buf[:length]
+	}
+	n, err := c.src.ReadAt(buf, offset)
+	if err != nil && !(errors.Is(err, io.EOF) && n > 0) {
+		return 0, err
+	}
+	return c.dst.WriteAt(buf[:n], offset)
+}
+
+// fallbackErr returns true if err indicates that a copy method is unsupported
+// for this pair of files, rather than an I/O failure
+func fallbackErr(err error) bool {
+	return errors.Is(err, unix.ENOSYS) ||
+		errors.Is(err, unix.EXDEV) ||
+		errors.Is(err, unix.EINVAL) ||
+		errors.Is(err, unix.EOPNOTSUPP)
+}
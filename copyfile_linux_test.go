@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyFile_Sparse(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "fdftest")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	const size = 64 << 20
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+
+	// Data in the middle, with holes on either side
+	src := filepath.Join(dir, "src")
+	f, err := os.Create(src)
+	assert.NoError(err)
+	_, err = f.WriteAt(data, size/2)
+	assert.NoError(err)
+	assert.NoError(f.Truncate(size))
+	assert.NoError(f.Close())
+
+	dst := filepath.Join(dir, "dst")
+	assert.NoError(copyFile(src, dst))
+
+	st, err := os.Stat(dst)
+	assert.NoError(err)
+	assert.Equal(int64(size), st.Size())
+
+	expected, err := ioutil.ReadFile(src)
+	assert.NoError(err)
+	actual, err := ioutil.ReadFile(dst)
+	assert.NoError(err)
+	assert.True(bytes.Equal(expected, actual))
+
+	if blocks := st.Sys().(*syscall.Stat_t).Blocks * 512; blocks >= size/2 {
+		assert.Failf("holes were not preserved", "%d bytes allocated", blocks)
+	}
+}
+
+func TestCopyFile_Fallback(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "fdftest")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	data := make([]byte, 3*fileBufferSize+123)
+	rand.Read(data)
+	src := filepath.Join(dir, "src")
+	assert.NoError(ioutil.WriteFile(src, data, 0666))
+
+	for _, c := range []*rangeCopier{
+		{noCopyFileRange: true},
+		{noCopyFileRange: true, noSendfile: true},
+	} {
+		sf, err := os.Open(src)
+		assert.NoError(err)
+		df, err := os.Create(filepath.Join(dir, "dst"))
+		assert.NoError(err)
+
+		c.src, c.dst = sf, df
+		assert.NoError(c.copySparse(int64(len(data))))
+		assert.Equal(int64(len(data)), c.data)
+		assert.Equal(int64(len(data)), c.written)
+		sf.Close()
+		df.Close()
+
+		actual, err := ioutil.ReadFile(df.Name())
+		assert.NoError(err)
+		assert.True(bytes.Equal(data, actual))
+	}
+}
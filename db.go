@@ -1,5 +1,7 @@
 package main
 
+import "sync"
+
 type queryGenerator func(r *fileRecord, q *query)
 
 var queryGenerators [][]queryGenerator
@@ -11,6 +13,7 @@ func init() {
 		2: func(r *fileRecord, q *query) { r.byPathSuffix(q) },
 		3: func(r *fileRecord, q *query) { r.bySize(q) },
 		4: func(r *fileRecord, q *query) { r.byChecksum(q) },
+		5: func(r *fileRecord, q *query) { r.byPrehash(q) },
 	}
 
 	// Use binary decrement to generate all possible subsets based on bit position
@@ -24,6 +27,16 @@ func init() {
 			continue
 		}
 
+		// queries will never include Prehash without Size
+		if (b>>5)&1 == 1 && (b>>3)&1 != 1 {
+			continue
+		}
+
+		// queries will never include both Prehash and Checksum, as the latter supersedes the former
+		if (b>>5)&1 == 1 && (b>>4)&1 == 1 {
+			continue
+		}
+
 		// queries will never include PathSuffix without Parent
 		if (b>>2)&1 == 1 && (b>>1)&1 != 1 {
 			continue
@@ -45,6 +58,7 @@ type query struct {
 	PathSuffix string
 	Size       int64
 	Checksum   checksum
+	Prehash    checksum
 }
 
 func (r *fileRecord) byName(q *query) *query {
@@ -77,8 +91,19 @@ func (r *fileRecord) byChecksum(q *query) *query {
 	return q
 }
 
+// If !HasPrehash, equivalent to bySize()
+func (r *fileRecord) byPrehash(q *query) *query {
+	q = r.bySize(q)
+	if r.HasPrehash {
+		q.Prehash = r.Prehash
+	}
+	return q
+}
+
 type db struct {
-	m map[query]recordSet
+	// Guards m against concurrent checksum updates when options.Jobs > 1
+	mutex sync.Mutex
+	m     map[query]recordSet
 }
 
 func newDB() *db {
@@ -88,6 +113,9 @@ func newDB() *db {
 }
 
 func (d *db) insert(r *fileRecord) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
 	var rs recordSet
 	var ok bool
 
@@ -106,6 +134,9 @@ func (d *db) insert(r *fileRecord) {
 }
 
 func (d *db) remove(r *fileRecord) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
 	for _, generatorSet := range queryGenerators {
 		var q query
 		for _, g := range generatorSet {
@@ -119,5 +150,8 @@ func (d *db) remove(r *fileRecord) {
 }
 
 func (d *db) query(q *query) recordSet {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
 	return d.m[*q]
 }
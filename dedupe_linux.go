@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const dedupeSupported = true
+
+// Maximum length of a single FIDEDUPERANGE request.
+// Btrfs silently truncates longer requests to 16MB.
+const dedupeChunkSize = 16 << 20
+
+var errDedupeDiffers = errors.New("contents differ")
+
+// dedupeFile shares the extents of src with dst, in place. The kernel verifies that
+// each range is identical before sharing it, and dst keeps its inode and metadata.
+// Returns the number of bytes deduplicated, which may be less than the file size on error.
+func dedupeFile(src, dst string) (deduped int64, err error) {
+	sf, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer sf.Close()
+
+	st, err := sf.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	// Unprivileged callers may only dedupe into a read-only fd if they own the file
+	df, err := os.OpenFile(dst, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrPermission) {
+		df, err = os.Open(dst)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer df.Close()
+
+	dt, err := df.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if dt.Size() != st.Size() {
+		return 0, fmt.Errorf("size changed from %d to %d", st.Size(), dt.Size())
+	}
+
+	size := st.Size()
+	for deduped < size {
+		length := size - deduped
+		if length > dedupeChunkSize {
+			length = dedupeChunkSize
+		}
+
+		r := unix.FileDedupeRange{
+			Src_offset: uint64(deduped),
+			Src_length: uint64(length),
+			Info: []unix.FileDedupeRangeInfo{{
+				Dest_fd:     int64(df.Fd()),
+				Dest_offset: uint64(deduped),
+			}},
+		}
+		if err = unix.IoctlFileDedupeRange(int(sf.Fd()), &r); err != nil {
+			return deduped, err
+		}
+
+		info := r.Info[0]
+		switch {
+		case info.Status == unix.FILE_DEDUPE_RANGE_DIFFERS:
+			return deduped, errDedupeDiffers
+		case info.Status < 0:
+			return deduped, syscall.Errno(-info.Status)
+		case info.Bytes_deduped == 0:
+			return deduped, fmt.Errorf("no progress at offset %d", deduped)
+		}
+		deduped += int64(info.Bytes_deduped)
+	}
+
+	return deduped, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// FIDEDUPERANGE requires a filesystem with extent sharing. To run this test:
+//
+//	truncate -s 1G /tmp/fdf.img && mkfs.btrfs /tmp/fdf.img
+//	mkdir -p /mnt/fdf && mount -o loop /tmp/fdf.img /mnt/fdf
+//	FDF_REFLINK_DIR=/mnt/fdf go test -run Dedupe
+func reflinkTestDir(t *testing.T) string {
+	dir := os.Getenv("FDF_REFLINK_DIR")
+	if dir == "" {
+		t.Skip("FDF_REFLINK_DIR not set")
+	}
+	dir, err := ioutil.TempDir(dir, "fdftest")
+	require.NoError(t, err)
+	return dir
+}
+
+func TestDedupeFile(t *testing.T) {
+	assert := require.New(t)
+	dir := reflinkTestDir(t)
+	defer os.RemoveAll(dir)
+
+	// Larger than a single request, and not a multiple of the block size
+	buf := make([]byte, dedupeChunkSize*2+1234)
+	rand.Read(buf)
+
+	a := filepath.Join(dir, "a")
+	b := filepath.Join(dir, "b")
+	c := filepath.Join(dir, "c")
+	assert.NoError(ioutil.WriteFile(a, buf, 0666))
+	assert.NoError(ioutil.WriteFile(b, buf, 0640))
+	buf[len(buf)-1]++
+	assert.NoError(ioutil.WriteFile(c, buf, 0666))
+
+	before, err := os.Stat(b)
+	assert.NoError(err)
+
+	deduped, err := dedupeFile(a, b)
+	assert.NoError(err)
+	assert.Equal(int64(len(buf)), deduped)
+
+	after, err := os.Stat(b)
+	assert.NoError(err)
+	assert.True(os.SameFile(before, after))
+	assert.Equal(os.FileMode(0640), after.Mode().Perm())
+
+	// The final chunk differs, so earlier chunks are shared but the call fails
+	deduped, err = dedupeFile(a, c)
+	assert.ErrorIs(err, errDedupeDiffers)
+	assert.Equal(int64(dedupeChunkSize*2), deduped)
+
+	content, err := ioutil.ReadFile(c)
+	assert.NoError(err)
+	assert.True(bytes.Equal(buf, content))
+}
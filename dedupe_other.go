@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+const dedupeSupported = false
+
+func dedupeFile(src, dst string) (deduped int64, err error) {
+	return 0, errors.New("--dedupe-extents is only supported on Linux")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// deviceCaps records which verbs are supported by the filesystem of a device
+type deviceCaps struct {
+	clone bool
+	link  bool
+}
+
+// deviceTable probes each device at most once
+type deviceTable struct {
+	mutex sync.Mutex
+	m     map[uint64]*deviceCaps
+}
+
+func newDeviceTable() *deviceTable {
+	return &deviceTable{
+		m: make(map[uint64]*deviceCaps),
+	}
+}
+
+// caps returns the capabilities of the device containing r.
+// Files on an unknown device are assumed to support everything,
+// leaving any failure to be reported by the verb itself.
+func (d *deviceTable) caps(r *fileRecord) *deviceCaps {
+	if !r.HasDev {
+		return &deviceCaps{clone: true, link: true}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	c, ok := d.m[r.Dev]
+	if !ok {
+		c = probeDevice(filepath.Dir(r.FilePath))
+		d.m[r.Dev] = c
+	}
+	return c
+}
+
+// probeDevice tests clone and hardlink support using temporary files in dir
+func probeDevice(dir string) *deviceCaps {
+	f, err := ioutil.TempFile(dir, ".fdf-probe-")
+	if err != nil {
+		// Unable to probe, e.g., a read-only directory
+		return &deviceCaps{clone: true, link: true}
+	}
+	src := f.Name()
+	defer os.Remove(src)
+
+	_, err = f.Write([]byte{0})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return &deviceCaps{clone: true, link: true}
+	}
+
+	c := &deviceCaps{}
+
+	dst := src + ".clone"
+	c.clone = cloneFile(src, dst) == nil
+	os.Remove(dst)
+
+	dst = src + ".link"
+	c.link = os.Link(src, dst) == nil
+	os.Remove(dst)
+
+	return c
+}
+
+// sameDevice returns true if r1 and r2 reside on the same device, or if either device is unknown
+func sameDevice(r1, r2 *fileRecord) bool {
+	return !r1.HasDev || !r2.HasDev || r1.Dev == r2.Dev
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTable_CrossDevice(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := newScanner()
+	scanner.options.clone = true
+	scanner.options.MatchMode = matchSize
+
+	onDevice := func(dev uint64) *fakeStat {
+		return &fakeStat{size: 1024, sys: &syscall.Stat_t{Dev: dev, Ino: 1}}
+	}
+
+	m, c1, err := scanner.table.findStat("foo", onDevice(1), "")
+	assert.Equal(c1, m)
+	assert.Equal(fileIsUnique, err)
+
+	// Only match is on another device, keep c2 for later matches
+	m, c2, err := scanner.table.findStat("bar", onDevice(2), "")
+	assert.Equal(c1, m)
+	assert.Equal(matchSize|matchCrossDev, err)
+
+	// Prefer the kept file on the same device
+	m, _, err = scanner.table.findStat("buzz", onDevice(2), "")
+	assert.Equal(c2, m)
+	assert.Equal(matchSize, err)
+
+	m, _, err = scanner.table.findStat("fizz", onDevice(1), "")
+	assert.Equal(c1, m)
+	assert.Equal(matchSize, err)
+}
+
+func TestScanner_OneFileSystem(t *testing.T) {
+	assert := require.New(t)
+
+	scanner := newScanner()
+	scanner.options.OneFileSystem = true
+	scanner.table.scanDir = "/root"
+	scanner.rootDevs = map[string]uint64{"/root": 1}
+
+	onDevice := func(dev uint64) *fakeStat {
+		return &fakeStat{isDir: true, sys: &syscall.Stat_t{Dev: dev, Ino: 1}}
+	}
+
+	assert.False(scanner.skipTraversal("/root/foo", onDevice(1)))
+	assert.True(scanner.skipTraversal("/root/mnt", onDevice(2)))
+
+	// Each scanned directory is compared with its own device
+	scanner.table.scanDir = "/root/mnt"
+	scanner.rootDevs["/root/mnt"] = 2
+	assert.False(scanner.skipTraversal("/root/mnt/bar", onDevice(2)))
+}
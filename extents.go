@@ -0,0 +1,114 @@
+package main
+
+// extent maps a range of a file to its physical location on disk
+type extent struct {
+	Logical  uint64
+	Physical uint64
+	Length   uint64
+
+	// false if Physical is meaningless, e.g., inline or delayed allocation
+	Located bool
+}
+
+type extentSharing int
+
+const (
+	extentsUnknown extentSharing = iota
+	extentsNotShared
+	extentsPartiallyShared
+	extentsShared
+)
+
+// extentsOf returns the cached extents of r, or nil if unavailable
+func extentsOf(r *fileRecord) []extent {
+	if r.extentsErr == nil && r.extents == nil {
+		r.extents, r.extentsErr = fileExtents(r.FilePath)
+		if r.extentsErr == nil && r.extents == nil {
+			r.extents = []extent{}
+		}
+	}
+	return r.extents
+}
+
+// sharedExtents determines whether r1 and r2 are already clones of each other
+func sharedExtents(r1, r2 *fileRecord) extentSharing {
+	if !extentsSupported || r1.Size() != r2.Size() || r1.Size() == 0 {
+		return extentsUnknown
+	}
+
+	e1, e2 := extentsOf(r1), extentsOf(r2)
+	if r1.extentsErr != nil || r2.extentsErr != nil {
+		return extentsUnknown
+	}
+	return compareExtents(e1, e2, uint64(r1.Size()))
+}
+
+// compareExtents counts the bytes within [0, size) that map to the same physical
+// location in both e1 and e2. Files are fully shared if every mapped byte is shared.
+func compareExtents(e1, e2 []extent, size uint64) extentSharing {
+	mapped := func(list []extent) (n uint64, ok bool) {
+		for _, e := range list {
+			if !e.Located {
+				return 0, false
+			}
+			if e.Logical < size {
+				n += min64(e.Logical+e.Length, size) - e.Logical
+			}
+		}
+		return n, true
+	}
+
+	m1, ok1 := mapped(e1)
+	m2, ok2 := mapped(e2)
+	if !ok1 || !ok2 || m1 == 0 || m2 == 0 {
+		return extentsUnknown
+	}
+
+	var shared uint64
+	for _, a := range e1 {
+		for _, b := range e2 {
+			// Clones share physical blocks at the same logical offset
+			if a.Physical-a.Logical != b.Physical-b.Logical {
+				continue
+			}
+			start := max64(a.Logical, b.Logical)
+			end := min64(min64(a.Logical+a.Length, b.Logical+b.Length), size)
+			if start < end {
+				shared += end - start
+			}
+		}
+	}
+
+	switch {
+	case shared == 0:
+		return extentsNotShared
+	case shared == m1 && shared == m2:
+		return extentsShared
+	}
+	return extentsPartiallyShared
+}
+
+// classifyExtents adds matchClone or matchPartial to a content match
+func classifyExtents(current, other *fileRecord, m matchFlag) matchFlag {
+	switch sharedExtents(current, other) {
+	case extentsShared:
+		return m | matchClone
+	case extentsPartiallyShared:
+		return m | matchPartial
+	}
+	return m
+}
+
+func min64(a, b uint64) uint64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,87 @@
+package main
+
+// #include <linux/fs.h>
+// #include <linux/fiemap.h>
+import "C"
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const extentsSupported = true
+
+// Mirrors struct fiemap, excluding the trailing fm_extents array
+type fiemapHeader struct {
+	Start         uint64
+	Length        uint64
+	Flags         uint32
+	MappedExtents uint32
+	ExtentCount   uint32
+	Reserved      uint32
+}
+
+// Mirrors struct fiemap_extent
+type fiemapExtent struct {
+	Logical    uint64
+	Physical   uint64
+	Length     uint64
+	Reserved64 [2]uint64
+	Flags      uint32
+	Reserved   [3]uint32
+}
+
+// Number of extents requested per FS_IOC_FIEMAP call
+const fiemapBatchSize = 256
+
+// Extents with these flags have no meaningful physical location, or their
+// physical location does not identify the data, e.g., compressed extents
+const fiemapUnlocated = C.FIEMAP_EXTENT_UNKNOWN | C.FIEMAP_EXTENT_DELALLOC | C.FIEMAP_EXTENT_ENCODED | C.FIEMAP_EXTENT_DATA_INLINE | C.FIEMAP_EXTENT_DATA_TAIL | C.FIEMAP_EXTENT_NOT_ALIGNED
+
+// fileExtents lists the extents of path via FS_IOC_FIEMAP
+func fileExtents(path string) (list []extent, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	headerSize := unsafe.Sizeof(fiemapHeader{})
+	extentSize := unsafe.Sizeof(fiemapExtent{})
+	buf := make([]byte, headerSize+extentSize*fiemapBatchSize)
+	header := (*fiemapHeader)(unsafe.Pointer(&buf[0]))
+
+	var start uint64
+	for {
+		*header = fiemapHeader{
+			Start:       start,
+			Length:      ^uint64(0) - start,
+			Flags:       C.FIEMAP_FLAG_SYNC,
+			ExtentCount: fiemapBatchSize,
+		}
+
+		if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), C.FS_IOC_FIEMAP, uintptr(unsafe.Pointer(&buf[0]))); errno != 0 {
+			return nil, errno
+		}
+
+		if header.MappedExtents == 0 {
+			return list, nil
+		}
+
+		for i := uintptr(0); i < uintptr(header.MappedExtents); i++ {
+			fe := (*fiemapExtent)(unsafe.Pointer(&buf[headerSize+i*extentSize]))
+			list = append(list, extent{
+				Logical:  fe.Logical,
+				Physical: fe.Physical,
+				Length:   fe.Length,
+				Located:  fe.Flags&fiemapUnlocated == 0,
+			})
+			start = fe.Logical + fe.Length
+			if fe.Flags&C.FIEMAP_EXTENT_LAST != 0 {
+				return list, nil
+			}
+		}
+	}
+}
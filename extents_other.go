@@ -0,0 +1,12 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+const extentsSupported = false
+
+func fileExtents(path string) ([]extent, error) {
+	return nil, errors.New("extent mapping is only supported on Linux")
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareExtents(t *testing.T) {
+	assert := require.New(t)
+
+	const block = 4096
+	original := []extent{
+		{Logical: 0, Physical: 100 * block, Length: 4 * block, Located: true},
+		{Logical: 4 * block, Physical: 200 * block, Length: 2 * block, Located: true},
+	}
+	size := uint64(6*block - 10)
+
+	// Extents may be split differently, but map to the same blocks
+	clone := []extent{
+		{Logical: 0, Physical: 100 * block, Length: 2 * block, Located: true},
+		{Logical: 2 * block, Physical: 102 * block, Length: 2 * block, Located: true},
+		{Logical: 4 * block, Physical: 200 * block, Length: 2 * block, Located: true},
+	}
+	assert.Equal(extentsShared, compareExtents(original, clone, size))
+	assert.Equal(extentsShared, compareExtents(clone, original, size))
+
+	// The second extent was rewritten after cloning
+	modified := []extent{
+		{Logical: 0, Physical: 100 * block, Length: 4 * block, Located: true},
+		{Logical: 4 * block, Physical: 300 * block, Length: 2 * block, Located: true},
+	}
+	assert.Equal(extentsPartiallyShared, compareExtents(original, modified, size))
+
+	// Same blocks, but at a different logical offset
+	shifted := []extent{
+		{Logical: 0, Physical: 200 * block, Length: 2 * block, Located: true},
+		{Logical: 2 * block, Physical: 100 * block, Length: 4 * block, Located: true},
+	}
+	assert.Equal(extentsNotShared, compareExtents(original, shifted, size))
+
+	// A hole in one file is not shared with data in the other
+	sparse := []extent{
+		{Logical: 0, Physical: 100 * block, Length: 4 * block, Located: true},
+	}
+	assert.Equal(extentsPartiallyShared, compareExtents(original, sparse, size))
+
+	unlocated := []extent{
+		{Logical: 0, Physical: 0, Length: 6 * block, Located: false},
+	}
+	assert.Equal(extentsUnknown, compareExtents(original, unlocated, size))
+	assert.Equal(extentsUnknown, compareExtents(original, nil, size))
+}
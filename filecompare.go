@@ -15,7 +15,38 @@ func areHardlinked(r1, r2 *fileRecord) bool {
 	return false
 }
 
+// Permission bits that must match for --link
+const linkModeMask = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+func sameOwnerAndMode(r1, r2 *fileRecord) bool {
+	if r1.Mode()&linkModeMask != r2.Mode()&linkModeMask {
+		return false
+	}
+
+	s1, ok1 := getStatInfo(r1.FileInfo)
+	s2, ok2 := getStatInfo(r2.FileInfo)
+	if !ok1 || !ok2 {
+		return true
+	}
+	return s1.Uid == s2.Uid && s1.Gid == s2.Gid
+}
+
 func equalFiles(r1, r2 *fileRecord, o *options) bool {
+	if equalContents(r1, r2, o) {
+		r1.everMatchedContent = true
+		r2.everMatchedContent = true
+		return true
+	}
+	return false
+}
+
+// equalContents is equalFiles without side effects on either record,
+// for use by concurrent comparisons.
+func equalContents(r1, r2 *fileRecord, o *options) bool {
+	if o.TrustHash && r1.HasChecksum && r2.HasChecksum {
+		return r1.Checksum == r2.Checksum
+	}
+
 	f1, err := o.OpenFile(r1.FilePath)
 	if err != nil {
 		return false
@@ -28,12 +59,7 @@ func equalFiles(r1, r2 *fileRecord, o *options) bool {
 	}
 	defer f2.Close()
 
-	if equalReaders(f1, f2) {
-		r1.everMatchedContent = true
-		r2.everMatchedContent = true
-		return true
-	}
-	return false
+	return equalReaders(f1, f2)
 }
 
 func equalReaders(f1, f2 io.Reader) bool {
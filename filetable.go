@@ -18,8 +18,20 @@ type fileTable struct {
 	// scanDir relative to the startup working directory
 	relDir string
 
+	// Set while walking the targets of symlinks for --follow-symlinks
+	viaSymlink bool
+
 	db *db
 
+	// Clone and hardlink support, probed once per device
+	devices *deviceTable
+
+	// Persistent checksums, nil unless --cache is specified
+	cache *checksumCache
+
+	// Records hashed by scanner.hashAhead, keyed by path, for findStat to adopt
+	hashed map[string]*fileRecord
+
 	// 0 == quiet, -1 == error/not a terminal
 	termWidth int
 
@@ -33,6 +45,7 @@ type fileTable struct {
 func newFileTable(o *options, t *totals) *fileTable {
 	return &fileTable{
 		db:      newDB(),
+		devices: newDeviceTable(),
 		options: o,
 		totals:  t,
 	}
@@ -59,11 +72,23 @@ type fileRecord struct {
 	// Lowercased parent directory basename.
 	FoldedParent string
 
+	// Device containing the file, if known. See getStatInfo.
+	HasDev bool
+	Dev    uint64
+
+	// Reached through a symlink by --follow-symlinks. FilePath is then the
+	// resolved target, and the file is always protected.
+	ViaSymlink bool
+
 	os.FileInfo
 	HasChecksum    bool
 	FailedChecksum error
 	Checksum       checksum
 
+	// Hash of the first and last few blocks, see Prehash
+	HasPrehash bool
+	Prehash    checksum
+
 	// true/false indicates whether this file is protected from destructive operations.
 	// nil if protection status has not yet been determined.
 	protect *bool
@@ -71,6 +96,14 @@ type fileRecord struct {
 	satisfiesKept *bool
 
 	everMatchedContent bool
+
+	// Set once a duplicate has been replaced by a symlink to this file,
+	// which must then remain the kept file so that the link stays valid
+	symlinked bool
+
+	// Physical extents, populated on demand by extentsOf
+	extents    []extent
+	extentsErr error
 }
 
 func foldName(filePath string) string {
@@ -88,7 +121,7 @@ func (r *fileRecord) SatisfiesKept(k *matchers.RuleSet) bool {
 // Note that `p` is ignored if there is already a cached result
 func (r *fileRecord) Protect(p *matchers.RuleSet) bool {
 	if r.protect == nil {
-		ok := p.Includes(r.FilePath)
+		ok := r.ViaSymlink || p.Includes(r.FilePath)
 		r.protect = &ok
 	}
 	return *r.protect
@@ -99,7 +132,7 @@ func (r *fileRecord) String() string {
 }
 
 func newFileRecord(path string, info os.FileInfo, relPath string, pathSuffix string) *fileRecord {
-	return &fileRecord{
+	r := &fileRecord{
 		FilePath:     path,
 		RelPath:      relPath,
 		PathSuffix:   pathSuffix,
@@ -107,6 +140,11 @@ func newFileRecord(path string, info os.FileInfo, relPath string, pathSuffix str
 		FoldedParent: foldName(filepath.Base(filepath.Dir(path))),
 		FileInfo:     info,
 	}
+	if s, ok := getStatInfo(info); ok {
+		r.HasDev = true
+		r.Dev = s.Dev
+	}
+	return r
 }
 
 // Rel returns absPath relative to the startup working directory,
@@ -151,6 +189,10 @@ const (
 	matchPathSuffix           = 0b0000000001000000 | matchParent  // path relative to the directory passed to scanner.Scan
 	matchNameSuffix           = 0b0000000010000000                // one filename must end with the other, e.g., "foo-fizz-buzz" and "fizz-buzz"
 	matchNamePrefix           = 0b0000000100000000                // one filename must begin with the other, e.g., "foo-fizz-buzz" and "foo-fizz"
+	matchClone                = 0b0000001000000000 | matchContent // used for categorization, files already share all extents
+	matchPartial              = 0b0000010000000000 | matchContent // used for categorization, files share some extents
+	matchMismatch             = 0b0000100000000000                // used for categorization, owner or permissions differ
+	matchCrossDev             = 0b0001000000000000                // used for categorization, files reside on different devices
 	fileIsUnique    matchFlag = 0b0010000000000000                // no match found
 	fileIsSkipped   matchFlag = 0b0100000000000000                // file was excluded e.g., due to size requirements
 	fileIsIgnored   matchFlag = 0b1000000000000000                // status returned for directories
@@ -191,33 +233,50 @@ func (t *fileTable) find(f, pathSuffix string) (match *fileRecord, current *file
 	return match, current, err
 }
 
+// candidateQuery returns the index key shared by every file that could match r
+func (t *fileTable) candidateQuery(r *fileRecord) *query {
+	q := &query{}
+	if t.options.MatchMode.has(matchName) {
+		r.byName(q)
+	}
+	if t.options.MatchMode.has(matchParent) {
+		r.byParent(q)
+	}
+	if t.options.MatchMode.has(matchPathSuffix) {
+		r.byPathSuffix(q)
+	}
+	if t.options.MatchMode.has(matchSize) {
+		r.bySize(q)
+	}
+	// Ignore checksums for now, as hardlinks can match content without the overhead of comparison
+	return q
+}
+
 func (t *fileTable) findStat(f string, st os.FileInfo, pathSuffix string) (match *fileRecord, current *fileRecord, err error) {
 	if st.IsDir() {
 		return nil, nil, fileIsIgnored
 	}
 
-	if st.Size() < t.options.MinSize() {
+	if t.options.filtered(st) {
 		return nil, nil, fileIsSkipped
 	}
 
 	current = newFileRecord(f, st, t.Rel(f), pathSuffix)
-
-	q := &query{}
-	if t.options.MatchMode.has(matchName) {
-		current.byName(q)
-	}
-	if t.options.MatchMode.has(matchParent) {
-		current.byParent(q)
+	if h, ok := t.hashed[f]; ok {
+		current.HasPrehash, current.Prehash = h.HasPrehash, h.Prehash
+		current.HasChecksum, current.Checksum = h.HasChecksum, h.Checksum
+		current.FailedChecksum = h.FailedChecksum
 	}
-	if t.options.MatchMode.has(matchPathSuffix) {
-		current.byPathSuffix(q)
-	}
-	if t.options.MatchMode.has(matchSize) {
-		current.bySize(q)
+	if t.viaSymlink {
+		// Never act through the link path, as it may lead outside the scanned directory
+		if current.FilePath, err = filepath.EvalSymlinks(f); err != nil {
+			return nil, nil, err
+		}
+		current.ViaSymlink = true
 	}
-	// Ignore checksums for now, as hardlinks can match content without the overhead of comparison
 
 	// Query for any known files that match all desired fields (except content/checksum)
+	q := t.candidateQuery(current)
 	candidates := t.db.query(q)
 
 	// If the current file is protected, filter for unprotected candidates
@@ -287,6 +346,36 @@ func (t *fileTable) findStat(f string, st os.FileInfo, pathSuffix string) (match
 		}
 	}
 
+	// --link must not merge files with different owners or permissions
+	var mismatched recordSet
+	if t.requireSameOwner() {
+		filtered := recordSet{}
+		mismatched = recordSet{}
+		for other := range candidates {
+			if sameOwnerAndMode(current, other) {
+				filtered[other] = struct{}{}
+			} else {
+				mismatched[other] = struct{}{}
+			}
+		}
+		candidates = filtered
+	}
+
+	// Prefer a kept file on the same device, as links and clones cannot cross devices
+	var crossDevice recordSet
+	if t.requireSameDevice() {
+		filtered := recordSet{}
+		crossDevice = recordSet{}
+		for other := range candidates {
+			if sameDevice(current, other) {
+				filtered[other] = struct{}{}
+			} else {
+				crossDevice[other] = struct{}{}
+			}
+		}
+		candidates = filtered
+	}
+
 	// --copy is not interested in non-hardlinks
 	if t.options.MatchMode.has(matchHardlink) {
 		t.db.insert(current)
@@ -298,35 +387,110 @@ func (t *fileTable) findStat(f string, st os.FileInfo, pathSuffix string) (match
 		for other := range candidates {
 			return other, current, t.options.MatchMode
 		}
+		for other := range crossDevice {
+			t.db.insert(current)
+			return other, current, t.options.MatchMode | matchCrossDev
+		}
+		for other := range mismatched {
+			t.db.insert(current)
+			return other, current, t.options.MatchMode | matchMismatch
+		}
 	}
 
 	// If we get here, we're matching content and no hardlink was found
-	// First we check any existing checksum matches for full equality
+	// Files that already share all extents are confirmed by checksum,
+	// which still skips the byte-for-byte comparison
+	if extentsSupported {
+		for other := range candidates {
+			if sharedExtents(current, other) == extentsShared && t.sameChecksum(current, other) {
+				current.everMatchedContent = true
+				other.everMatchedContent = true
+				return other, current, t.options.MatchMode | matchClone
+			}
+		}
+	}
+
+	// Next we check any existing checksum matches for full equality
 	if current.HasChecksum {
 		current.byChecksum(q)
 		existingChecksums := t.db.query(q)
 
 		for other := range existingChecksums {
+			if _, ok := mismatched[other]; ok {
+				continue
+			}
+			if _, ok := crossDevice[other]; ok {
+				continue
+			}
 			if equalFiles(current, other, t.options) {
-				return other, current, t.options.MatchMode
+				return other, current, classifyExtents(current, other, t.options.MatchMode)
 			}
 		}
 	}
 
 	if other := t.checkCandidates(current, candidates); other != nil {
-		return other, current, t.options.MatchMode
+		return other, current, classifyExtents(current, other, t.options.MatchMode)
+	}
+
+	// Report otherwise-matching files that cannot be merged,
+	// but index current so that it can be kept for later matches.
+	if len(crossDevice) != 0 {
+		if other := t.checkCandidates(current, crossDevice); other != nil {
+			t.db.insert(current)
+			return other, current, t.options.MatchMode | matchCrossDev
+		}
+	}
+	if len(mismatched) != 0 {
+		if other := t.checkCandidates(current, mismatched); other != nil {
+			t.db.insert(current)
+			return other, current, t.options.MatchMode | matchMismatch
+		}
 	}
 
 	t.db.insert(current)
 	return current, current, fileIsUnique
 }
 
+// sameChecksum returns true if current and other both checksum successfully and agree
+func (t *fileTable) sameChecksum(current, other *fileRecord) bool {
+	if err := t.Checksum(current, false); err != nil {
+		return false
+	}
+	if err := t.Checksum(other, true); err != nil {
+		return false
+	}
+	return current.Checksum == other.Checksum
+}
+
+// requireSameOwner returns true if matches must share uid, gid, and permissions
+func (t *fileTable) requireSameOwner() bool {
+	return t.options.Verb() == VerbMakeLinks && !t.options.LinkMismatched
+}
+
+// requireSameDevice returns true if the selected verb cannot operate across devices
+func (t *fileTable) requireSameDevice() bool {
+	switch t.options.Verb() {
+	case VerbMakeLinks, VerbClone, VerbDedupe, VerbAuto:
+		return true
+	}
+	return false
+}
+
 func (t *fileTable) checkCandidates(current *fileRecord, candidates recordSet) (other *fileRecord) {
 	// If there were no checksum matches, we need to look at any otherwise-matching files with no checksum yet
 	if len(candidates) == 0 {
 		return nil
 	}
 
+	if t.options.Jobs > 1 {
+		return t.checkCandidatesParallel(current, candidates)
+	}
+
+	// Avoid reading large files in full if they differ near either end
+	if candidates = t.prehashCandidates(current, candidates); len(candidates) == 0 {
+		return nil
+	}
+
 	if err := t.Checksum(current, false); err != nil {
 		// We might still find a hardlink match later, even without deep comparison
 		return nil
@@ -346,3 +510,37 @@ func (t *fileTable) checkCandidates(current *fileRecord, candidates recordSet) (
 
 	return nil
 }
+
+// prehashCandidates returns the subset of candidates with the same Prehash as current.
+// Returns candidates unmodified if current is too small to benefit from prehashing.
+func (t *fileTable) prehashCandidates(current *fileRecord, candidates recordSet) recordSet {
+	if !t.usePrehash(current) {
+		return candidates
+	}
+
+	if err := t.Prehash(current, false); err != nil {
+		return nil
+	}
+
+	// Previously prehashed candidates can be found via the index
+	filtered := recordSet{}
+	for other := range t.db.query(current.byPrehash(t.candidateQuery(current))) {
+		if _, ok := candidates[other]; ok {
+			filtered[other] = struct{}{}
+		}
+	}
+
+	for other := range candidates {
+		if other.HasPrehash {
+			continue
+		}
+		if err := t.Prehash(other, true); err != nil {
+			continue
+		}
+		if other.Prehash == current.Prehash {
+			filtered[other] = struct{}{}
+		}
+	}
+
+	return filtered
+}
@@ -59,12 +59,17 @@ type fakeStat struct {
 
 	isDir bool
 	size  int64
+	sys   interface{}
 }
 
 func (s *fakeStat) IsDir() bool {
 	return s.isDir
 }
 
+func (s *fakeStat) Sys() interface{} {
+	return s.sys
+}
+
 func (s *fakeStat) Size() int64 {
 	return s.size
 }
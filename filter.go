@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/josephvusich/fdf/report"
+)
+
+// Fields compared by --newer-than and --older-than
+const (
+	TimeModified = "mtime"
+	TimeChanged  = "ctime"
+)
+
+var validTimeFields = map[string]struct{}{
+	TimeModified: {},
+	TimeChanged:  {},
+}
+
+// Accepted by --newer-than and --older-than, in addition to durations
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// filtered returns true if a file is excluded by the size or time filters.
+// It only requires the result of os.Stat, so that no record is created.
+func (o *options) filtered(st os.FileInfo) bool {
+	if st.Size() < o.MinSize() || (o.maxSize != 0 && st.Size() > o.maxSize) {
+		return true
+	}
+	if o.NewerThan.IsZero() && o.OlderThan.IsZero() {
+		return false
+	}
+
+	t := st.ModTime()
+	if o.TimeField == TimeChanged {
+		if s, ok := getStatInfo(st); ok {
+			t = s.Ctime
+		}
+	}
+	return (!o.NewerThan.IsZero() && !t.After(o.NewerThan)) || (!o.OlderThan.IsZero() && !t.Before(o.OlderThan))
+}
+
+// Filters describes the active size and time filters for the JSON report
+func (o *options) Filters() *report.Filters {
+	r := &report.Filters{
+		MinimumSize: o.MinSize(),
+		MaximumSize: o.maxSize,
+	}
+	if !o.NewerThan.IsZero() {
+		r.NewerThan = &o.NewerThan
+	}
+	if !o.OlderThan.IsZero() {
+		r.OlderThan = &o.OlderThan
+	}
+	if r.NewerThan != nil || r.OlderThan != nil {
+		r.TimeField = o.TimeField
+	}
+	return r
+}
+
+// sizeFlag is a file size in bytes, given with optional units such as 10M or 2GiB
+type sizeFlag struct {
+	size *int64
+}
+
+func (s sizeFlag) String() string {
+	if s.size == nil {
+		return "0"
+	}
+	return strconv.FormatInt(*s.size, 10)
+}
+
+func (s sizeFlag) Set(v string) error {
+	n, err := parseSize(v)
+	if err != nil {
+		return err
+	}
+	*s.size = n
+	return nil
+}
+
+// sizeRangeFlag sets both the minimum and maximum size from MIN:MAX,
+// where either may be omitted to leave it unchanged
+type sizeRangeFlag struct {
+	min, max *int64
+}
+
+func (s sizeRangeFlag) String() string {
+	return ""
+}
+
+func (s sizeRangeFlag) Set(v string) error {
+	i := strings.Index(v, ":")
+	if i < 0 {
+		return errors.New("must be MIN:MAX")
+	}
+	if min := v[:i]; min != "" {
+		if err := (sizeFlag{s.min}).Set(min); err != nil {
+			return err
+		}
+	}
+	if max := v[i+1:]; max != "" {
+		if err := (sizeFlag{s.max}).Set(max); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseSize(v string) (int64, error) {
+	n, err := humanize.ParseBytes(v)
+	if err != nil {
+		return 0, err
+	}
+	if n > 1<<63-1 {
+		return 0, fmt.Errorf("%s is too large", v)
+	}
+	return int64(n), nil
+}
+
+// timeFlag is a point in time, given as a date or as a duration before now
+type timeFlag struct {
+	t *time.Time
+}
+
+func (f timeFlag) String() string {
+	if f.t == nil || f.t.IsZero() {
+		return ""
+	}
+	return f.t.Format(time.RFC3339)
+}
+
+func (f timeFlag) Set(v string) error {
+	t, err := parseTime(v, time.Now())
+	if err != nil {
+		return err
+	}
+	*f.t = t
+	return nil
+}
+
+// parseTime parses v as a date in the local time zone, or as a duration before now.
+// Durations accept the units of time.ParseDuration, along with d for days and w for weeks.
+func parseTime(v string, now time.Time) (time.Time, error) {
+	if d, err := parseAge(v); err == nil {
+		if d < 0 {
+			return time.Time{}, errors.New("duration must not be negative")
+		}
+		return now.Add(-d), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.New("must be a date such as 2006-01-02, or a duration such as 36h or 7d")
+}
+
+func parseAge(v string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	} {
+		if strings.HasSuffix(v, suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(v, suffix), 64)
+			if err != nil {
+				return 0, err
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+	return time.ParseDuration(v)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTime(t *testing.T) {
+	assert := require.New(t)
+	now := time.Date(2020, 5, 10, 12, 0, 0, 0, time.UTC)
+
+	for v, expected := range map[string]time.Time{
+		"36h":                  now.Add(-36 * time.Hour),
+		"1.5d":                 now.Add(-36 * time.Hour),
+		"2w":                   now.Add(-14 * 24 * time.Hour),
+		"2020-05-01":           time.Date(2020, 5, 1, 0, 0, 0, 0, time.Local),
+		"2020-05-01 08:30":     time.Date(2020, 5, 1, 8, 30, 0, 0, time.Local),
+		"2020-05-01T08:30:00Z": time.Date(2020, 5, 1, 8, 30, 0, 0, time.UTC),
+	} {
+		actual, err := parseTime(v, now)
+		assert.NoError(err, v)
+		assert.True(expected.Equal(actual), "%s: %s", v, actual)
+	}
+
+	for _, v := range []string{"", "yesterday", "-1h", "2020-13-01"} {
+		_, err := parseTime(v, now)
+		assert.Error(err, v)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	assert := require.New(t)
+
+	for v, expected := range map[string]int64{
+		"100":   100,
+		"10K":   10000,
+		"2M":    2000000,
+		"1G":    1000000000,
+		"10KiB": 10 << 10,
+		"2MiB":  2 << 20,
+		"1GiB":  1 << 30,
+	} {
+		actual, err := parseSize(v)
+		assert.NoError(err, v)
+		assert.Equal(expected, actual, v)
+	}
+}
+
+func TestScanner_Filters(t *testing.T) {
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./a",
+		},
+		content: map[string]string{
+			"s": "x",
+			"m": "0123456789",
+			"l": strings.Repeat("x", 1100),
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		old := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		assert.NoError(os.Chtimes("a/l", old, old))
+
+		for _, x := range []struct {
+			args    []string
+			files   uint64
+			indexed bool
+		}{
+			{nil, 3, true},
+			{[]string{`--maximum-size`, `10`}, 2, false},
+			{[]string{`--two-phase`, `--maximum-size`, `10`}, 2, false},
+			{[]string{`--size`, `2:1K`}, 1, false},
+			{[]string{`--size`, `1KiB:`}, 1, true},
+			{[]string{`-z`, `2B`}, 2, true},
+			{[]string{`--older-than`, `2001-01-01`}, 1, true},
+			{[]string{`--newer-than`, `30d`}, 2, false},
+			{[]string{`--newer-than`, `1999-01-01`, `--older-than`, `2001-01-01`}, 1, true},
+		} {
+			scanner := newScanner()
+			assert.Empty(scanner.options.ParseArgs(append([]string{`fdf`, `-r`}, x.args...)))
+			assert.NoError(scanner.Scan())
+			assert.Equal(x.files, scanner.totals.Files.count, "%v", x.args)
+
+			// Filtered files never enter the index
+			assert.Equal(x.indexed, len(scanner.table.db.query(&query{Size: 1100})) != 0, "%v", x.args)
+		}
+
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `--maximum-size`, `2M`, `--newer-than`, `2001-01-01`}))
+		f := scanner.options.Filters()
+		assert.Equal(int64(1), f.MinimumSize)
+		// Single-letter units are decimal
+		assert.Equal(int64(2000000), f.MaximumSize)
+		assert.NotNil(f.NewerThan)
+		assert.Nil(f.OlderThan)
+		assert.Equal(TimeModified, f.TimeField)
+	})
+}
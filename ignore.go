@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Read from each walked directory, see --gitignore for additional names
+const fdfIgnoreFile = ".fdfignore"
+
+// ignoreRule is a single pattern of an ignore file, using gitignore syntax
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreFiles returns the names of the ignore files read from each directory
+func (o *options) ignoreFiles() []string {
+	if o.GitIgnore {
+		return []string{".gitignore", fdfIgnoreFile}
+	}
+	return []string{fdfIgnoreFile}
+}
+
+// isIgnoreFile returns true if name is one of the ignore files in use,
+// which are never scanned, as removing one would change what is ignored
+func (o *options) isIgnoreFile(name string) bool {
+	for _, n := range o.ignoreFiles() {
+		if name == n {
+			return true
+		}
+	}
+	return false
+}
+
+// loadIgnores reads the ignore files of dir, whose rules apply to every entry below it.
+// Returns an error if an ignore file exists but cannot be read, in which case dir
+// must be skipped rather than scanned without its rules.
+func (f *scanner) loadIgnores(dir string) error {
+	var rules []*ignoreRule
+	for _, name := range f.options.ignoreFiles() {
+		path := filepath.Join(dir, name)
+		r, err := readIgnoreFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		rules = append(rules, r...)
+	}
+
+	if len(rules) != 0 {
+		if f.ignores == nil {
+			f.ignores = make(map[string][]*ignoreRule)
+		}
+		f.ignores[dir] = rules
+	}
+	return nil
+}
+
+// ignored returns true if path is matched by the ignore files of the directories
+// between it and the scanned directory. Rules in deeper directories take precedence,
+// and within each directory the last matching rule wins.
+func (f *scanner) ignored(path string, isDir bool) bool {
+	if len(f.ignores) == 0 {
+		return false
+	}
+
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == f.table.scanDir || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	ignored := false
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rules, ok := f.ignores[dirs[i]]
+		if !ok {
+			continue
+		}
+		rel, err := filepath.Rel(dirs[i], path)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, r := range rules {
+			if (!r.dirOnly || isDir) && r.re.MatchString(rel) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// readIgnoreFile parses the ignore file at path, reporting and skipping any invalid lines
+func readIgnoreFile(path string) ([]*ignoreRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseIgnore(f, func(n int, err error) {
+		fmt.Printf("%s: line %d: %s, skipping\n", path, n, err)
+	})
+}
+
+// parseIgnore calls invalid for each line that is not a valid pattern, and
+// omits it from rules, as git does. Only read errors are returned.
+func parseIgnore(r io.Reader, invalid func(n int, err error)) (rules []*ignoreRule, err error) {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		rule, err := parseIgnoreLine(s.Text())
+		if err != nil {
+			invalid(n, err)
+			continue
+		}
+		if rule != nil {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, s.Err()
+}
+
+// parseIgnoreLine returns nil for blank lines and comments
+func parseIgnoreLine(line string) (*ignoreRule, error) {
+	line = strings.TrimSuffix(line, "\r")
+
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return nil, nil
+	}
+
+	r := &ignoreRule{}
+	if line[0] == '!' {
+		r.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return nil, nil
+	}
+
+	// Patterns containing a slash are relative to the directory of the ignore file,
+	// otherwise they match the name of an entry at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var err error
+	r.re, err = regexp.Compile(ignorePattern(line, anchored))
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ignorePattern translates a gitignore pattern into a regular expression
+// that matches slash-separated paths relative to the directory of the ignore file
+func ignorePattern(p string, anchored bool) string {
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+
+	for i := 0; i < len(p); {
+		atSegment := i == 0 || p[i-1] == '/'
+		switch {
+		case atSegment && strings.HasPrefix(p[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 3
+		case atSegment && p[i:] == "**":
+			b.WriteString(".*")
+			i += 2
+		case p[i] == '*':
+			b.WriteString("[^/]*")
+			i++
+		case p[i] == '?':
+			b.WriteString("[^/]")
+			i++
+		case p[i] == '[' && classEnd(p, i) > 0:
+			end := classEnd(p, i)
+			class := p[i+1 : end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, "[", `\[`) + "]")
+			i = end + 1
+		case p[i] == '\\' && i+1 < len(p):
+			_, size := utf8.DecodeRuneInString(p[i+1:])
+			b.WriteString(regexp.QuoteMeta(p[i+1 : i+1+size]))
+			i += 1 + size
+		default:
+			_, size := utf8.DecodeRuneInString(p[i:])
+			b.WriteString(regexp.QuoteMeta(p[i : i+size]))
+			i += size
+		}
+	}
+
+	b.WriteString("$")
+	return b.String()
+}
+
+// classEnd returns the index of the bracket closing the character class at p[start],
+// or -1 if it is unterminated. A bracket immediately after the opening one is literal.
+func classEnd(p string, start int) int {
+	i := start + 1
+	if i < len(p) && p[i] == '!' {
+		i++
+	}
+	if i < len(p) && p[i] == ']' {
+		i++
+	}
+	for ; i < len(p); i++ {
+		switch p[i] {
+		case '\\':
+			i++
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIgnorePattern(t *testing.T) {
+	assert := require.New(t)
+
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		expect  bool
+	}{
+		{"*.log", "x.log", false, true},
+		{"*.log", "a/b/x.log", false, true},
+		{"*.log", "a/x.logs", false, false},
+		{"/x.log", "x.log", false, true},
+		{"/x.log", "a/x.log", false, false},
+		{"doc/*.txt", "doc/a.txt", false, true},
+		{"doc/*.txt", "doc/b/a.txt", false, false},
+		{"doc/*.txt", "a/doc/a.txt", false, false},
+		{"**/doc", "a/b/doc", true, true},
+		{"**/doc", "doc", true, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**", "a/x/y", false, true},
+		{"a/**", "a", true, false},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "src/build", true, true},
+		{"file?.[ch]", "file1.c", false, true},
+		{"file?.[!ch]", "file1.c", false, false},
+		{"file?.[!ch]", "file1.o", false, true},
+		{`\#keep`, "#keep", false, true},
+		{`\!keep`, "!keep", false, true},
+		{`trailing\ `, "trailing ", false, true},
+		{"[unterminated", "[unterminated", false, true},
+		{"ünï*", "a/ünïcode", false, true},
+	}
+
+	for _, x := range tests {
+		r, err := parseIgnoreLine(x.pattern)
+		assert.NoError(err, x.pattern)
+		assert.NotNil(r, x.pattern)
+		actual := (!r.dirOnly || x.isDir) && r.re.MatchString(x.path)
+		assert.Equal(x.expect, actual, "%s: %s", x.pattern, x.path)
+	}
+
+	for _, line := range []string{"", "   ", "# comment", "!", "/"} {
+		r, err := parseIgnoreLine(line)
+		assert.NoError(err)
+		assert.Nil(r, line)
+	}
+
+	// Invalid lines are skipped without discarding the rest of the file
+	var invalid []int
+	rules, err := parseIgnore(strings.NewReader("*.tmp\n\n# comment\r\n[z-a]\n!keep.tmp\r\n"), func(n int, err error) {
+		invalid = append(invalid, n)
+	})
+	assert.NoError(err)
+	assert.Len(rules, 2)
+	assert.True(rules[1].negate)
+	assert.Equal([]int{4}, invalid)
+}
+
+func TestScanner_Ignore(t *testing.T) {
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./a",
+			"./a/b",
+			"./a/b/c",
+			"./build",
+		},
+		content: map[string]string{
+			"x.tmp":    "foobar",
+			"keep.tmp": "foobar",
+			"y":        "foobar",
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		assert.NoError(ioutil.WriteFile(".fdfignore", []byte("*.tmp\nbuild/\n/y\n"), 0666))
+		assert.NoError(ioutil.WriteFile("a/b/.fdfignore", []byte("!keep.tmp\nc/y\n"), 0666))
+		assert.NoError(ioutil.WriteFile("a/.gitignore", []byte("y\n"), 0666))
+
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`}))
+		assert.NoError(scanner.Scan())
+
+		// a/y, a/b/y, a/b/keep.tmp, and a/b/c/keep.tmp
+		assert.Equal(uint64(4), scanner.totals.Files.count)
+
+		scanner = newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `--gitignore`}))
+		assert.NoError(scanner.Scan())
+
+		// a/b/keep.tmp and a/b/c/keep.tmp
+		assert.Equal(uint64(2), scanner.totals.Files.count)
+
+		// Ignore files in use are never scanned, even with --hidden
+		scanner = newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `--hidden`}))
+		assert.NoError(scanner.Scan())
+
+		// a/.gitignore, a/y, a/b/y, a/b/keep.tmp, and a/b/c/keep.tmp
+		assert.Equal(uint64(5), scanner.totals.Files.count)
+
+		// A directory whose ignore file cannot be read is skipped
+		assert.NoError(os.Remove("a/b/.fdfignore"))
+		assert.NoError(os.Mkdir("a/b/.fdfignore", 0777))
+		scanner = newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`}))
+		assert.NoError(scanner.Scan())
+
+		// a/y
+		assert.Equal(uint64(1), scanner.totals.Files.count)
+		assert.Equal(uint64(1), scanner.totals.Errors.count)
+	})
+}
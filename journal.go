@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Actions recorded in the journal, named after the corresponding flags
+const (
+	JournalLink    = "link"
+	JournalClone   = "clone"
+	JournalCopy    = "copy"
+	JournalDelete  = "delete"
+	JournalTrash   = "trash"
+	JournalDedupe  = "dedupe-extents"
+	JournalMove    = "move-to"
+	JournalSymlink = "symlink"
+	JournalPrune   = "prune-symlinks"
+
+	// Recorded only in plans, as devices are probed when the plan is applied.
+	// Journals record the verb selected by --auto.
+	JournalAuto = "auto"
+)
+
+// Each action is journaled as pending before it is taken, then again once its outcome is known
+const (
+	JournalPending = "pending"
+	JournalDone    = "done"
+	JournalFailed  = "failed"
+)
+
+// Names of verbs that modify files, as recorded in journals and plans
+var verbNames = map[verb]string{
+	VerbMakeLinks:  JournalLink,
+	VerbClone:      JournalClone,
+	VerbSplitLinks: JournalCopy,
+	VerbDelete:     JournalDelete,
+	VerbDedupe:     JournalDedupe,
+	VerbMove:       JournalMove,
+	VerbAuto:       JournalAuto,
+	VerbSymlink:    JournalSymlink,
+}
+
+// journalEntry is a single line of the --journal file. It records an action
+// taken by the scanner, along with enough of the replaced file to reverse it.
+type journalEntry struct {
+	Time   time.Time `json:"time"`
+	Verb   string    `json:"verb"`
+	Status string    `json:"status"`
+
+	// Absolute paths of the kept and replaced files
+	Kept     string `json:"kept"`
+	Replaced string `json:"replaced"`
+
+	// New path of the replaced file, for --move-to and --trash
+	Moved string `json:"moved,omitempty"`
+
+	// Text of a symlink deleted by --prune-symlinks
+	Link string `json:"link,omitempty"`
+
+	// Replaced file prior to the action
+	Dev      uint64      `json:"dev,omitempty"`
+	Ino      uint64      `json:"ino,omitempty"`
+	Size     int64       `json:"size"`
+	Mode     os.FileMode `json:"mode"`
+	HasOwner bool        `json:"has_owner"`
+	Uid      int         `json:"uid"`
+	Gid      int         `json:"gid"`
+	Atime    time.Time   `json:"atime"`
+	Mtime    time.Time   `json:"mtime"`
+
+	// Extended attributes, including POSIX ACLs on Linux
+	Xattrs map[string][]byte `json:"xattrs,omitempty"`
+
+	// Checksum of the full contents shared by both files, if known
+	Hash     string `json:"hash,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+}
+
+// journal appends entries to the --journal file, syncing each to disk
+type journal struct {
+	mutex sync.Mutex
+	f     *os.File
+}
+
+func openJournal(path string) (*journal, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{f: f}, nil
+}
+
+func (j *journal) record(e *journalEntry) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if err := json.NewEncoder(j.f).Encode(e); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// begin records e as pending, before the action it describes is taken.
+// moved is the new path of the replaced file, if already known.
+func (j *journal) begin(e *journalEntry, moved string) error {
+	e.Status = JournalPending
+	e.Moved = moved
+	return j.record(e)
+}
+
+// complete records the outcome of an action previously passed to begin
+func (j *journal) complete(e *journalEntry, moved string, err error) error {
+	done := *e
+	done.Time = time.Now()
+	done.Status = JournalDone
+	if err != nil {
+		done.Status = JournalFailed
+	}
+	if moved != "" {
+		done.Moved = moved
+	}
+	return j.record(&done)
+}
+
+func (j *journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	return j.f.Close()
+}
+
+// newJournalEntry describes the replacement of current with match by verb
+func (f *scanner) newJournalEntry(v verb, match, current *fileRecord) (*journalEntry, error) {
+	e := &journalEntry{
+		Time:     time.Now(),
+		Kept:     match.FilePath,
+		Replaced: current.FilePath,
+		Size:     current.Size(),
+		Mode:     current.Mode(),
+		Atime:    current.ModTime(),
+		Mtime:    current.ModTime(),
+	}
+
+	e.Verb = verbNames[v]
+	if v == VerbDelete && f.options.Trash {
+		e.Verb = JournalTrash
+	}
+
+	if s, ok := getStatInfo(current.FileInfo); ok {
+		e.Dev, e.Ino = s.Dev, s.Ino
+		e.HasOwner = true
+		e.Uid, e.Gid = int(s.Uid), int(s.Gid)
+		e.Atime = s.Atime
+	}
+
+	var err error
+	if e.Xattrs, err = listXattrs(current.FilePath); err != nil {
+		return nil, err
+	}
+
+	// Checksums of partial contents cannot be verified by undo
+	if f.options.SkipHeader == 0 && f.options.SkipFooter == 0 {
+		for _, r := range []*fileRecord{current, match} {
+			if r.HasChecksum {
+				e.Hash = f.options.hashAlgorithm()
+				e.Checksum = checksumHex(e.Hash, r.Checksum)
+				break
+			}
+		}
+	}
+	return e, nil
+}
+
+// intend journals e as pending, if --journal is in use, before perform acts on
+// the replaced file. moved is the new path of the replaced file, if any.
+func (f *scanner) intend(e *journalEntry, moved string) error {
+	if e == nil {
+		return nil
+	}
+	if err := f.journal.begin(e, moved); err != nil {
+		return fmt.Errorf("unable to write journal: %w", err)
+	}
+	return nil
+}
+
+// checksumHex encodes c without the zero padding of shorter digests
+func checksumHex(algorithm string, c checksum) string {
+	h, err := hashAlgorithms[algorithm].new()
+	if err != nil {
+		panic(fmt.Sprintf("invalid hash algorithm %s: %s", algorithm, err))
+	}
+	return hex.EncodeToString(c.hash[:h.Size()])
+}
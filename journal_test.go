@@ -0,0 +1,158 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal_Undo(t *testing.T) {
+	assert := require.New(t)
+
+	testUndo := func(args []string, check func(l *testLayout)) {
+		l := &testLayout{
+			dirs: []string{
+				"./d",
+			},
+			content: map[string]string{
+				"a": "foobar",
+				"b": "foobar",
+				"c": "foobar",
+			},
+		}
+
+		setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+			journalPath, err := filepath.Abs("journal.jsonl")
+			assert.NoError(err)
+
+			scanner := newScanner()
+			assert.Empty(scanner.options.ParseArgs(append([]string{`fdf`, `-r`, `--timestamps`, `ignore`, `--hash`, `sha256`, `--journal`, journalPath}, args...)))
+			assert.NoError(scanner.Scan())
+			assert.Equal(uint64(2), scanner.totals.Processed.count)
+
+			// Each action is recorded as pending, then as done
+			entries, err := readJournal(journalPath)
+			assert.NoError(err)
+			assert.Len(entries, 4)
+			for i, e := range entries {
+				assert.Equal([]string{JournalPending, JournalDone}[i%2], e.Status)
+				assert.NotEmpty(e.Checksum)
+				assert.Equal(HashSHA256, e.Hash)
+			}
+			assert.Len(journalActions(entries), 2)
+			check(l)
+
+			assert.Equal(0, undo([]string{journalPath}))
+			assert.NoError(os.Remove(journalPath))
+			validate(l)
+
+			a, err := os.Stat("d/a")
+			assert.NoError(err)
+			for _, name := range []string{"d/b", "d/c"} {
+				st, err := os.Stat(name)
+				assert.NoError(err)
+				assert.False(os.SameFile(a, st), name)
+			}
+		})
+	}
+
+	testUndo([]string{`--link`}, func(l *testLayout) {
+		a, err := os.Stat("d/a")
+		assert.NoError(err)
+		b, err := os.Stat("d/b")
+		assert.NoError(err)
+		assert.True(os.SameFile(a, b))
+	})
+
+	testUndo([]string{`--move-to`, `q`}, func(l *testLayout) {
+		_, err := os.Stat("d/b")
+		assert.True(os.IsNotExist(err))
+		assert.NoError(os.Remove(filepath.Join("q", quarantineManifest)))
+	})
+}
+
+func TestJournal_UndoCopy(t *testing.T) {
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./d",
+		},
+		content: map[string]string{
+			"a": "foobar",
+			"b": "foobar",
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		journalPath, err := filepath.Abs("journal.jsonl")
+		assert.NoError(err)
+		assert.NoError(os.Link("d/a", "d/c"))
+		assert.NoError(os.Link("d/a", "d/e"))
+
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `--timestamps`, `ignore`, `--hash`, `sha256`, `--copy`, `--copy-unlinked`, `--journal`, journalPath}))
+		assert.NoError(scanner.Scan())
+		assert.Equal(uint64(3), scanner.totals.Processed.count)
+
+		// An edit made to a split copy since the run must not be lost
+		assert.NoError(ioutil.WriteFile("d/e", []byte("foobaz"), 0666))
+
+		// Only d/c was hardlinked before the run
+		assert.Equal(1, undo([]string{journalPath}))
+		assert.NoError(os.Remove(journalPath))
+
+		a, err := os.Stat("d/a")
+		assert.NoError(err)
+		for name, linked := range map[string]bool{"d/b": false, "d/c": true, "d/e": false} {
+			st, err := os.Stat(name)
+			assert.NoError(err)
+			assert.Equal(linked, os.SameFile(a, st), name)
+		}
+		b, err := ioutil.ReadFile("d/e")
+		assert.NoError(err)
+		assert.Equal("foobaz", string(b))
+
+		assert.NoError(os.Remove("d/c"))
+		assert.NoError(os.Remove("d/e"))
+		validate(l)
+	})
+}
+
+func TestJournal_UndoDelete(t *testing.T) {
+	assert := require.New(t)
+
+	dir, err := ioutil.TempDir("", "fdftest")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	j, err := openJournal(filepath.Join(dir, "journal.jsonl"))
+	assert.NoError(err)
+	assert.NoError(j.record(&journalEntry{Verb: JournalDelete, Replaced: filepath.Join(dir, "gone")}))
+	assert.NoError(j.Close())
+
+	assert.Equal(1, undo([]string{filepath.Join(dir, "journal.jsonl")}))
+}
+
+func TestJournal_Actions(t *testing.T) {
+	assert := require.New(t)
+
+	entries := []*journalEntry{
+		{Verb: JournalMove, Status: JournalPending, Replaced: "a"},
+		{Verb: JournalLink, Status: JournalPending, Replaced: "b"},
+		{Verb: JournalMove, Status: JournalDone, Replaced: "a", Moved: "q/a"},
+		{Verb: JournalLink, Status: JournalFailed, Replaced: "b"},
+		{Verb: JournalClone, Status: JournalPending, Replaced: "c"},
+	}
+
+	// Failed actions are dropped, and interrupted actions remain pending
+	actions := journalActions(entries)
+	assert.Len(actions, 2)
+	assert.Equal("a", actions[0].Replaced)
+	assert.Equal(JournalDone, actions[0].Status)
+	assert.Equal("q/a", actions[0].Moved)
+	assert.Equal("c", actions[1].Replaced)
+	assert.Equal(JournalPending, actions[1].Status)
+}
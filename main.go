@@ -14,6 +14,16 @@ func main() {
 		defer terminalANSI(prevANSI)
 	}
 
+	// A file or directory named undo or apply is scanned instead
+	if len(os.Args) > 1 && !pathExists(os.Args[1]) {
+		switch os.Args[1] {
+		case "undo":
+			os.Exit(undo(os.Args[2:]))
+		case "apply":
+			os.Exit(apply(os.Args[2:]))
+		}
+	}
+
 	scanner := newScanner()
 	dirs := scanner.options.ParseArgs(os.Args)
 
@@ -30,7 +40,7 @@ func main() {
 
 	fmt.Printf("\033[2K\n%s\n", scanner.totals.PrettyFormat(scanner.options.Verb()))
 
-	if err := writeReport(scanner.options.JsonReport, scanner.table.pairs, scanner.table.namePairs, scanner.table.db); err != nil {
+	if err := writeReport(scanner.options.JsonReport, scanner.table.pairs, scanner.table.namePairs, scanner.table.db, scanner.options.Filters(), scanner.audit); err != nil {
 		fmt.Println("Unable to write JSON report:", err)
 	}
 
@@ -39,3 +49,8 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+func pathExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+const (
+	MetadataPreserveDuplicate = "preserve-duplicate"
+	MetadataTakeKept          = "take-kept"
+	MetadataIgnore            = "ignore"
+)
+
+var validMetadataFlags = map[string]struct{}{
+	MetadataPreserveDuplicate: {},
+	MetadataTakeKept:          {},
+	MetadataIgnore:            {},
+}
+
+// fileMetadata is the subset of file metadata carried over to replacement files
+type fileMetadata struct {
+	Mode os.FileMode
+
+	HasOwner bool
+	Uid      int
+	Gid      int
+
+	Atime time.Time
+	Mtime time.Time
+
+	// Extended attributes, including POSIX ACLs on Linux
+	Xattrs map[string][]byte
+}
+
+func readMetadata(path string) (*fileMetadata, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &fileMetadata{
+		Mode:  st.Mode(),
+		Atime: st.ModTime(),
+		Mtime: st.ModTime(),
+	}
+
+	if s, ok := getStatInfo(st); ok {
+		m.HasOwner = true
+		m.Uid = int(s.Uid)
+		m.Gid = int(s.Gid)
+		m.Atime = s.Atime
+	}
+
+	if m.Xattrs, err = listXattrs(path); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// apply copies m to path. Ownership and extended attributes are only
+// applied where permitted, as they may require elevated privileges.
+func (m *fileMetadata) apply(path string) error {
+	if m.HasOwner {
+		if err := os.Lchown(path, m.Uid, m.Gid); err != nil && !errors.Is(err, os.ErrPermission) {
+			return err
+		}
+	}
+
+	// After chown, which clears security.capability
+	if err := setXattrs(path, m.Xattrs); err != nil {
+		return err
+	}
+
+	// After chown, which may clear setuid and setgid bits
+	if err := os.Chmod(path, m.Mode); err != nil {
+		return err
+	}
+
+	return os.Chtimes(path, m.Atime, m.Mtime)
+}
+
+// copyMetadata applies options.MetadataPolicy to a replacement for dupe,
+// which has been written to tmp
+func (o *options) copyMetadata(kept, dupe *fileRecord, tmp string) error {
+	src := dupe.FilePath
+	switch o.MetadataPolicy {
+	case MetadataIgnore:
+		return nil
+	case MetadataTakeKept:
+		src = kept.FilePath
+	}
+
+	m, err := readMetadata(src)
+	if err != nil {
+		return err
+	}
+	return m.apply(tmp)
+}
@@ -0,0 +1,113 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestScanner_Metadata(t *testing.T) {
+	assert := require.New(t)
+	ts := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	testMetadata := func(policy string, expectMode os.FileMode, expectPreserved bool) {
+		l := &testLayout{
+			dirs: []string{
+				"./d",
+			},
+			content: map[string]string{
+				"a": "foobar",
+				"b": "foobar",
+			},
+		}
+
+		setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+			assert.NoError(os.Chmod("d/b", 0600))
+			assert.NoError(os.Chtimes("d/b", ts, ts))
+			xattrs := unix.Setxattr("d/b", "user.fdf", []byte("test"), 0) == nil
+
+			before, err := os.Stat("d/b")
+			assert.NoError(err)
+
+			scanner := newScanner()
+			assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-rc`, `--copy-unlinked`, `--timestamps`, `ignore`, `--metadata`, policy}))
+			assert.NoError(scanner.Scan())
+			assert.Equal(uint64(1), scanner.totals.Processed.count)
+
+			after, err := os.Stat("d/b")
+			assert.NoError(err)
+			assert.False(os.SameFile(before, after), "d/b was not replaced")
+			assert.Equal(expectMode, after.Mode().Perm(), policy)
+			assert.Equal(expectPreserved, ts.Equal(after.ModTime()), policy)
+
+			if xattrs {
+				buf := make([]byte, 16)
+				n, err := unix.Getxattr("d/b", "user.fdf", buf)
+				if expectPreserved {
+					assert.NoError(err)
+					assert.Equal("test", string(buf[:n]))
+				} else {
+					assert.Error(err)
+				}
+			}
+			validate(l)
+		})
+	}
+
+	umask := unix.Umask(0)
+	unix.Umask(umask)
+	created := 0666 &^ os.FileMode(umask)
+
+	testMetadata(MetadataPreserveDuplicate, 0600, true)
+	testMetadata(MetadataTakeKept, created, false)
+	testMetadata(MetadataIgnore, created, false)
+}
+
+func TestScanner_LinkMismatched(t *testing.T) {
+	assert := require.New(t)
+
+	testLink := func(args []string, expectLinked bool) {
+		l := &testLayout{
+			dirs: []string{
+				"./d",
+			},
+			content: map[string]string{
+				"a": "foobar",
+				"b": "foobar",
+			},
+		}
+
+		setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+			assert.NoError(os.Chmod("d/a", 0644))
+			assert.NoError(os.Chmod("d/b", 0600))
+
+			scanner := newScanner()
+			assert.Empty(scanner.options.ParseArgs(append([]string{`fdf`, `-rl`, `--timestamps`, `ignore`}, args...)))
+			assert.NoError(scanner.Scan())
+
+			a, err := os.Stat("d/a")
+			assert.NoError(err)
+			b, err := os.Stat("d/b")
+			assert.NoError(err)
+			assert.Equal(expectLinked, os.SameFile(a, b))
+
+			if expectLinked {
+				assert.Equal(uint64(1), scanner.totals.Processed.count)
+				assert.Equal(uint64(0), scanner.totals.Mismatched.count)
+			} else {
+				assert.Equal(uint64(0), scanner.totals.Processed.count)
+				assert.Equal(uint64(1), scanner.totals.Mismatched.count)
+			}
+			validate(l)
+		})
+	}
+
+	testLink(nil, false)
+	testLink([]string{`--link-mismatched`}, true)
+}
@@ -0,0 +1,10 @@
+package main
+
+// Extended attributes are not supported on Windows
+func listXattrs(path string) (map[string][]byte, error) {
+	return nil, nil
+}
+
+func setXattrs(path string, xattrs map[string][]byte) error {
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/josephvusich/go-getopt"
 	"github.com/josephvusich/go-matchers"
@@ -27,6 +28,16 @@ const (
 	VerbSplitLinks
 	VerbMakeLinks
 	VerbDelete
+	VerbDedupe
+	VerbAuto
+	VerbMove
+	VerbSymlink
+)
+
+// Styles of link target for --symlink
+const (
+	SymlinkRelative = "relative"
+	SymlinkAbsolute = "absolute"
 )
 
 const (
@@ -41,6 +52,12 @@ var (
 		TimestampNewer:  {},
 		TimestampOlder:  {},
 	}
+
+	validHashFlags = map[string]struct{}{
+		HashHighway: {},
+		HashSHA256:  {},
+		HashCRC64:   {},
+	}
 )
 
 func (v verb) PastTense() string {
@@ -55,6 +72,14 @@ func (v verb) PastTense() string {
 		return "hardlinked"
 	case VerbDelete:
 		return "deleted"
+	case VerbDedupe:
+		return "deduplicated"
+	case VerbAuto:
+		return "cloned or hardlinked"
+	case VerbMove:
+		return "moved"
+	case VerbSymlink:
+		return "symlinked"
 	}
 	return fmt.Sprintf("unknown verb value %d", v)
 }
@@ -64,6 +89,14 @@ type options struct {
 	splitLinks  bool
 	makeLinks   bool
 	deleteDupes bool
+	dedupe      bool
+	auto        bool
+
+	// Move deleted files into the FreeDesktop.org trash
+	Trash bool
+
+	// Style of link target for --symlink, or empty if not selected
+	Symlink string
 
 	MatchMode matchFlag
 
@@ -73,20 +106,102 @@ type options struct {
 	MustKeep  matchers.RuleSet
 
 	TimestampBehavior string
+	MetadataPolicy    string
+
+	Recursive      bool
+	OneFileSystem  bool
+	HiddenDirs     bool
+	HiddenFiles    bool
+	TwoPhase       bool
+	FollowSymlinks bool
+	GitIgnore      bool
+	AuditSymlinks  bool
+	PruneSymlinks  bool
 
-	Recursive bool
+	// Maximum number of files to hash or compare concurrently
+	Jobs int
+
+	// Depth limits relative to each scanned directory, where 0 is unlimited
+	MaxDepth int
+	MinDepth int
 
 	minSize    int64
+	maxSize    int64
 	SkipHeader int64
 	SkipFooter int64
 
 	IgnoreExistingLinks bool
+	LinkMismatched      bool
 	CopyUnlinked        bool
 	Quiet               bool
 	Verbose             bool
 	DryRun              bool
 
+	// Names skipped without a warning, in addition to defaultSilentSkip
+	SilentSkip nameSet
+
+	// Absolute paths of the directories passed to scanner.Scan, see pathMatcher
+	scanRoots []string
+
 	JsonReport string
+	MoveTo     string
+	Journal    string
+	PlanFile   string
+	ScriptFile string
+	CacheFile  string
+
+	HashAlgorithm string
+	TrustHash     bool
+
+	// Only scan files whose TimeField is within these bounds, if set
+	NewerThan time.Time
+	OlderThan time.Time
+	TimeField string
+}
+
+// hashAlgorithm returns the --hash name, or the default if unspecified
+func (o *options) hashAlgorithm() string {
+	if o.HashAlgorithm == "" {
+		return HashHighway
+	}
+	return o.HashAlgorithm
+}
+
+// twoPhase returns true if every file is enumerated before any are compared,
+// as with --two-phase, which --jobs implies so that whole buckets are hashed together
+func (o *options) twoPhase() bool {
+	return o.TwoPhase || o.Jobs > 1
+}
+
+// includeHidden returns true if dot-prefixed entries of type typ are scanned
+func (o *options) includeHidden(typ os.FileMode) bool {
+	if typ.IsDir() {
+		return o.HiddenDirs
+	}
+	return o.HiddenFiles
+}
+
+func (o *options) silentSkip(name string) bool {
+	if _, ok := defaultSilentSkip[name]; ok {
+		return true
+	}
+	_, ok := o.SilentSkip[name]
+	return ok
+}
+
+// nameSet is a set of file names, given by a repeatable flag
+type nameSet map[string]struct{}
+
+func (n nameSet) String() string {
+	return keysToStringList(n)
+}
+
+func (n nameSet) Set(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return errors.New("must be a file or directory name, not a path")
+	}
+	n[name] = struct{}{}
+	return nil
 }
 
 func keysToStringList(m map[string]struct{}) string {
@@ -233,10 +348,80 @@ func (o *options) Verb() verb {
 		return VerbSplitLinks
 	case o.deleteDupes:
 		return VerbDelete
+	case o.dedupe:
+		return VerbDedupe
+	case o.auto:
+		return VerbAuto
+	case o.MoveTo != "":
+		return VerbMove
+	case o.Symlink != "":
+		return VerbSymlink
 	}
 	return VerbNone
 }
 
+// verbCount returns the number of verbs selected, as Verb only reports the first
+func (o *options) verbCount() (n int) {
+	for _, set := range []bool{o.makeLinks, o.clone, o.splitLinks, o.deleteDupes, o.dedupe, o.auto, o.MoveTo != "", o.Symlink != ""} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// setVerb selects v as if by its flag. VerbMove is selected by MoveTo instead.
+func (o *options) setVerb(v verb) {
+	switch v {
+	case VerbMakeLinks:
+		o.makeLinks = true
+	case VerbClone:
+		o.clone = true
+	case VerbSplitLinks:
+		o.splitLinks = true
+	case VerbDelete:
+		o.deleteDupes = true
+	case VerbDedupe:
+		o.dedupe = true
+	case VerbAuto:
+		o.auto = true
+	case VerbSymlink:
+		if o.Symlink == "" {
+			o.Symlink = SymlinkRelative
+		}
+	}
+}
+
+// symlinkFlag is the value of --symlink, which may be given alone or as --symlink=STYLE
+type symlinkFlag struct {
+	style *string
+}
+
+func (s symlinkFlag) String() string {
+	if s.style == nil {
+		return ""
+	}
+	return *s.style
+}
+
+func (s symlinkFlag) Set(v string) error {
+	switch v {
+	case "true":
+		*s.style = SymlinkRelative
+	case "false":
+		*s.style = ""
+	case SymlinkRelative, SymlinkAbsolute:
+		*s.style = v
+	default:
+		return fmt.Errorf("must be %s or %s", SymlinkRelative, SymlinkAbsolute)
+	}
+	return nil
+}
+
+func (s symlinkFlag) IsBoolFlag() bool {
+	return true
+}
+
 func (o *options) MinSize() int64 {
 	if o.SkipHeader > 0 && o.SkipHeader+1 > o.minSize {
 		return o.SkipHeader + 1
@@ -248,40 +433,87 @@ func (o *options) ParseArgs(args []string) (dirs []string) {
 	fs := getopt.NewFlagSet(args[0], flag.ContinueOnError)
 	fs.Usage = func() {
 		fmt.Fprint(os.Stderr,
-			"usage: fdf [--clone | --copy | --delete | --link] [-hqrtv]\n"+
-				"        [-m FIELDS] [-z BYTES] [-n LENGTH]\n"+
-				"        [--protect PATTERN] [--unprotect PATTERN] [directory ...]\n\n")
+			"usage: fdf [--auto | --clone | --copy | --dedupe-extents | --delete | --link |\n"+
+				"        --move-to DIR | --symlink[=STYLE]] [-hqrtv] [-m FIELDS] [-z BYTES]\n"+
+				"        [-n LENGTH] [--protect PATTERN] [--unprotect PATTERN] [directory ...]\n\n")
 		fs.PrintDefaults()
 	}
 	badOptions := false
 
 	o.Protect.DefaultInclude = false
-	protect, unprotect := o.Protect.FlagValues(globMatcher)
+	protect, unprotect := o.Protect.FlagValues(o.globMatcher)
+	protectRegex, unprotectRegex := o.Protect.FlagValues(o.regexMatcher)
 	protectDir, unprotectDir := o.Protect.FlagValues(globMatcherFromDir)
 
 	o.Exclude.DefaultInclude = false
-	exclude, include := o.Exclude.FlagValues(globMatcher)
+	exclude, include := o.Exclude.FlagValues(o.globMatcher)
+	excludeRegex, includeRegex := o.Exclude.FlagValues(o.regexMatcher)
 	excludeDir, includeDir := o.Exclude.FlagValues(globMatcherFromDir)
 
 	o.MustKeep.DefaultInclude = true
-	mustKeep, mustNotKeep := o.MustKeep.FlagValues(globMatcher)
+	mustKeep, mustNotKeep := o.MustKeep.FlagValues(o.globMatcher)
+	mustKeepRegex, mustNotKeepRegex := o.MustKeep.FlagValues(o.regexMatcher)
 	mustKeepDir, mustNotKeepDir := o.MustKeep.FlagValues(globMatcherFromDir)
 
 	fs.BoolVar(&o.clone, "clone", false, "(verb) create copy-on-write clones instead of hardlinks (not supported on all filesystems)")
 	fs.BoolVar(&o.splitLinks, "copy", false, "(verb) split existing hardlinks via copy\nmutually exclusive with --ignore-hardlinks")
 	fs.BoolVar(&o.Recursive, "recursive", false, "traverse subdirectories")
+	fs.BoolVar(&o.FollowSymlinks, "follow-symlinks", false, "descend into symlinked directories, and compare symlinked files by their targets\n"+
+		"each target is walked once, and files reached through a symlink are never modified")
+	fs.BoolVar(&o.AuditSymlinks, "symlink-audit", false, "report symlinks that share a target with an earlier symlink, and broken symlinks\n"+
+		"links are also grouped by target and by link text in the --json-report")
+	fs.BoolVar(&o.PruneSymlinks, "prune-symlinks", false, "delete the symlinks reported by --symlink-audit, keeping one link to each target\n"+
+		"protected links are always kept, and implies --symlink-audit")
+	fs.BoolVar(&o.GitIgnore, "gitignore", false, "skip files and directories matched by .gitignore files, as well as "+fdfIgnoreFile+" files")
+	hidden := fs.Bool("hidden", false, "scan dot-prefixed files and directories, which are otherwise skipped")
+	fs.BoolVar(&o.HiddenDirs, "hidden-dirs", false, "traverse dot-prefixed directories")
+	fs.BoolVar(&o.HiddenFiles, "hidden-files", false, "scan dot-prefixed files")
+	o.SilentSkip = nameSet{}
+	fs.Var(o.SilentSkip, "silent-skip", "always skip files and directories named `NAME`, without a warning\n"+
+		"may appear more than once, in addition to "+keysToStringList(defaultSilentSkip))
+	fs.BoolVar(&o.OneFileSystem, "one-file-system", false, "don't descend into directories on other filesystems than the scanned directory (not supported on Windows)")
+	fs.IntVar(&o.MaxDepth, "max-depth", 0, "with --recursive, scan files at most `N` levels below each scanned directory\n"+
+		"files within the scanned directory itself are at level 1")
+	fs.IntVar(&o.MinDepth, "min-depth", 0, "with --recursive, skip files fewer than `N` levels below each scanned directory")
+	fs.BoolVar(&o.TwoPhase, "two-phase", false, "enumerate all files before comparing any, skipping files with no possible match")
 	fs.BoolVar(&o.makeLinks, "link", false, "(verb) hardlink duplicate files")
 	fs.BoolVar(&o.deleteDupes, "delete", false, "(verb) delete duplicate files")
+	fs.BoolVar(&o.Trash, "trash", false, "with --delete, move duplicates into the FreeDesktop.org trash so they can be restored\n"+
+		"files on filesystems without a usable trash directory are left in place")
+	fs.StringVar(&o.MoveTo, "move-to", "", "(verb) move duplicate files into `DIR`, mirroring their paths relative to the scanned directory\n"+
+		"a manifest in DIR records the original location of each file, and DIR is never scanned")
+	fs.Var(symlinkFlag{&o.Symlink}, "symlink", "(verb) replace duplicate files with symbolic links to the kept file\n"+
+		"link targets are relative unless --symlink=absolute is specified")
+	fs.BoolVar(&o.auto, "auto", false, "(verb) clone duplicates where supported, otherwise hardlink them\n"+
+		"duplicates on different filesystems are reported but left unchanged")
+	fs.BoolVar(&o.dedupe, "dedupe-extents", false, "(verb) share extents in place via FIDEDUPERANGE, keeping each duplicate's inode and metadata\n"+
+		"the kernel verifies contents before sharing (Linux only, not supported on all filesystems)")
 	fs.BoolVar(&o.DryRun, "dry-run", false, "don't actually do anything, just show what would be done")
 	fs.BoolVar(&o.IgnoreExistingLinks, "ignore-hardlinks", false, "ignore existing hardlinks\nmutually exclusive with --copy")
+	fs.BoolVar(&o.LinkMismatched, "link-mismatched", false, "allow --link or --auto to merge files with different owners or permissions")
 	fs.BoolVar(&o.CopyUnlinked, "copy-unlinked", false, "always copy over matching files even if not hardlinked")
 	fs.BoolVar(&o.Quiet, "quiet", false, "don't display current filename during scanning")
 	fs.BoolVar(&o.Verbose, "verbose", false, "display additional details regarding protected paths")
 	helpFlag := fs.Bool("help", false, "show this help screen and exit")
-	fs.Int64Var(&o.minSize, "minimum-size", 1, "skip files smaller than `BYTES`, must be greater than the sum of --skip-header and --skip-footer")
+	fs.IntVar(&o.Jobs, "jobs", 1, "hash and compare up to `N` files concurrently, implies --two-phase")
+	o.minSize = 1
+	fs.Var(sizeFlag{&o.minSize}, "minimum-size", "skip files smaller than `BYTES`, must be greater than the sum of --skip-header and --skip-footer\n"+
+		"sizes may include decimal units such as 10K or 1G (powers of 1000), or binary units such as 2MiB (powers of 1024)")
+	fs.Var(sizeFlag{&o.maxSize}, "maximum-size", "skip files larger than `BYTES`")
+	fs.Var(sizeRangeFlag{&o.minSize, &o.maxSize}, "size", "only scan files with sizes in `RANGE`, given as MIN:MAX where either may be omitted, e.g.: 10M:2G")
+	fs.Var(timeFlag{&o.NewerThan}, "newer-than", "only scan files whose --time-field is after `TIME`, which is either a date such as 2006-01-02,\n"+
+		"an RFC 3339 timestamp, or a duration before now such as 36h, 7d, or 2w")
+	fs.Var(timeFlag{&o.OlderThan}, "older-than", "only scan files whose --time-field is before `TIME`, see --newer-than")
+	fs.StringVar(&o.TimeField, "time-field", TimeModified, "compare --newer-than and --older-than with `FIELD`, either mtime (modified) or ctime (status changed)")
 	fs.Int64Var(&o.SkipHeader, "skip-header", 0, "skip `LENGTH` bytes at the beginning of each file when comparing")
 	fs.Int64Var(&o.SkipFooter, "skip-footer", 0, "skip `LENGTH` bytes at the end of each file when comparing")
-	fs.Var(exclude, "exclude", "exclude files matching `GLOB` from scanning")
+	fs.Var(exclude, "exclude", "exclude files matching `GLOB` from scanning\n"+
+		"relative globs match paths relative to the working directory or to any scanned directory\n"+
+		"globs beginning with i: match case-insensitively, e.g.: i:**/*.jpg\n"+
+		"on Windows, i:\\ and i:/ refer to drive I: instead")
+	fs.Var(excludeRegex, "exclude-regex", "exclude files whose path matches `REGEX` from scanning\n"+
+		"matched against the absolute path and the path relative to each scanned directory, using / on all platforms")
+	fs.Var(includeRegex, "include-regex", "include files whose path matches `REGEX`, opposite of --exclude-regex")
 	fs.Var(excludeDir, "exclude-dir", "exclude `DIR` from scanning, throws error if DIR does not exist")
 	fs.Var(include, "include", "include `GLOB`, opposite of --exclude")
 	fs.Var(includeDir, "include-dir", "include `DIR`, throws error if DIR does not exist")
@@ -291,11 +523,18 @@ func (o *options) ParseArgs(args []string) (dirs []string) {
 	fs.Var(protect, "preserve", "(deprecated) alias for --protect `PATTERN`")
 	fs.Var(protectDir, "protect-dir", "similar to --protect 'DIR/**/*', but throws error if `DIR` does not exist")
 	fs.Var(unprotect, "unprotect", "remove files added by --protect\nmay appear more than once\nrules are applied in the order specified")
+	fs.Var(protectRegex, "protect-regex", "similar to --protect, for files whose path matches `REGEX`")
+	fs.Var(unprotectRegex, "unprotect-regex", "similar to --unprotect, for files whose path matches `REGEX`")
 	fs.Var(unprotectDir, "unprotect-dir", "similar to --unprotect 'DIR/**/*', but throws error if `DIR` does not exist")
 	fs.Var(mustKeep, "if-kept", "only remove files if the 'kept' file matches the provided `GLOB`")
 	fs.Var(mustNotKeep, "if-not-kept", "only remove files if the 'kept' file does NOT match the provided `GLOB`")
+	fs.Var(mustKeepRegex, "if-kept-regex", "only remove files if the path of the 'kept' file matches `REGEX`")
+	fs.Var(mustNotKeepRegex, "if-not-kept-regex", "only remove files if the path of the 'kept' file does NOT match `REGEX`")
 	fs.Var(mustKeepDir, "if-kept-dir", "only remove files if the 'kept' file is a descendant of `DIR`")
 	fs.Var(mustNotKeepDir, "if-not-kept-dir", "only remove files if the 'kept' file is NOT a descendant of `DIR`")
+	fs.StringVar(&o.MetadataPolicy, "metadata", MetadataPreserveDuplicate, "when replacing a duplicate via --clone or --copy, take its mode, owner, timestamps and extended attributes from\n"+
+		"the duplicate itself (preserve-duplicate), the kept file (take-kept), or neither (ignore)\n"+
+		"`POLICY` must be one of "+keysToStringList(validMetadataFlags))
 	fs.StringVar(&o.TimestampBehavior, "timestamps", TimestampOlder, "`MODE` must be one of "+keysToStringList(validTimestampFlags))
 	matchSpec := fs.String("match", "", "Evaluate `FIELDS` to determine file equality, where valid fields are:\n"+
 		"  name (case insensitive)\n"+
@@ -322,6 +561,15 @@ func (o *options) ParseArgs(args []string) (dirs []string) {
 		"specify multiple fields using '+', e.g.: name+content")
 	allowNoContent := fs.Bool("ignore-content", false, "allow --match without 'content'")
 	fs.StringVar(&o.JsonReport, "json-report", "", "on completion, dump JSON match data to `FILE`")
+	fs.StringVar(&o.HashAlgorithm, "hash", HashHighway, "checksum `ALGORITHM` must be one of "+keysToStringList(validHashFlags))
+	fs.BoolVar(&o.TrustHash, "trust-hash", false, "treat matching checksums as equal content without comparing files byte-by-byte\n"+
+		"requires a cryptographic --hash, such as "+HashSHA256)
+	fs.StringVar(&o.Journal, "journal", "", "append a record of every change to `FILE`, which can be reversed by 'fdf undo FILE'")
+	fs.StringVar(&o.PlanFile, "plan", "", "write every intended action to `FILE` instead of acting, to be reviewed and run by 'fdf apply FILE'\n"+
+		"implies --dry-run")
+	fs.StringVar(&o.ScriptFile, "script", "", "write a POSIX shell script to `FILE` that performs every intended action instead of acting\n"+
+		"implies --dry-run, and is not supported with --dedupe-extents or --trash")
+	fs.StringVar(&o.CacheFile, "cache", "", "reuse checksums of unchanged files across runs, stored in `FILE`")
 
 	fs.Alias("a", "clone")
 	fs.Alias("c", "copy")
@@ -332,21 +580,124 @@ func (o *options) ParseArgs(args []string) (dirs []string) {
 	fs.Alias("v", "verbose")
 	fs.Alias("t", "dry-run")
 	fs.Alias("h", "ignore-hardlinks")
+	fs.Alias("j", "jobs")
 	fs.Alias("z", "minimum-size")
 	fs.Alias("m", "match")
 	fs.Alias("n", "skip-header")
 	fs.Alias("p", "protect")
+	fs.Alias("x", "one-file-system")
 
 	if err := fs.Parse(args[1:]); err != nil {
 		os.Exit(1)
 	}
 
 	var err error
+	if o.PlanFile != "" {
+		if o.Verb() == VerbNone {
+			fmt.Println("--plan requires a verb")
+			badOptions = true
+		}
+		o.DryRun = true
+	}
+
+	if o.PruneSymlinks {
+		o.AuditSymlinks = true
+	}
+
+	if o.OneFileSystem && !statSupported {
+		fmt.Println("--one-file-system is not supported on Windows")
+		badOptions = true
+	}
+
+	if o.maxSize != 0 && o.maxSize < o.MinSize() {
+		fmt.Println("--maximum-size must not be smaller than --minimum-size")
+		badOptions = true
+	}
+
+	if _, ok := validTimeFields[o.TimeField]; !ok {
+		fmt.Println("--time-field must be one of:", keysToStringList(validTimeFields))
+		badOptions = true
+	} else if o.TimeField == TimeChanged && !statSupported {
+		fmt.Println("--time-field ctime is not supported on Windows")
+		badOptions = true
+	}
+
+	if !o.NewerThan.IsZero() && !o.OlderThan.IsZero() && !o.NewerThan.Before(o.OlderThan) {
+		fmt.Println("--newer-than must be earlier than --older-than")
+		badOptions = true
+	}
+
+	if o.MaxDepth < 0 || o.MinDepth < 0 {
+		fmt.Println("--max-depth and --min-depth must not be negative")
+		badOptions = true
+	} else if o.MaxDepth != 0 && o.MinDepth > o.MaxDepth {
+		fmt.Println("--min-depth must not be greater than --max-depth")
+		badOptions = true
+	}
+
+	if *hidden {
+		o.HiddenDirs = true
+		o.HiddenFiles = true
+	}
+
+	if o.ScriptFile != "" {
+		switch {
+		case o.Verb() == VerbNone:
+			fmt.Println("--script requires a verb")
+			badOptions = true
+		case o.dedupe || o.Trash:
+			fmt.Println("--script has no shell equivalent for --dedupe-extents or --trash")
+			badOptions = true
+		case o.PlanFile != "":
+			fmt.Println("Invalid flag combination: --plan and --script are mutually exclusive")
+			badOptions = true
+		}
+		o.DryRun = true
+	}
+
+	if o.verbCount() > 1 {
+		fmt.Println("Invalid flag combination: only one verb may be specified")
+		badOptions = true
+	}
+
 	if o.Quiet && o.Verbose {
 		fmt.Println("Invalid flag combination: --quiet and --verbose are mutually exclusive")
 		badOptions = true
 	}
 
+	if o.Jobs < 1 {
+		fmt.Println("--jobs must be at least 1")
+		badOptions = true
+	}
+
+	if o.dedupe && !dedupeSupported {
+		fmt.Println("--dedupe-extents is only supported on Linux")
+		badOptions = true
+	}
+
+	if o.Trash && !o.deleteDupes {
+		fmt.Println("--trash is only valid with --delete")
+		badOptions = true
+	} else if o.Trash && !trashSupported {
+		fmt.Println("--trash is not supported on Windows")
+		badOptions = true
+	}
+
+	if o.LinkMismatched && !o.makeLinks && !o.auto {
+		fmt.Println("--link-mismatched is only valid with --link or --auto")
+		badOptions = true
+	}
+
+	if o.MoveTo != "" {
+		if m, err := quarantineMatcher(o.MoveTo); err != nil {
+			fmt.Println("Invalid --move-to parameter:", err)
+			badOptions = true
+		} else {
+			// Never scan previously moved duplicates, regardless of --include
+			o.Exclude.Add(m, true)
+		}
+	}
+
 	if o.CopyUnlinked && !o.splitLinks {
 		fmt.Println("--copy-unlinked is only valid with --copy")
 		badOptions = true
@@ -357,6 +708,19 @@ func (o *options) ParseArgs(args []string) (dirs []string) {
 		badOptions = true
 	}
 
+	if _, ok := validMetadataFlags[o.MetadataPolicy]; !ok {
+		fmt.Println("--metadata must be one of:", keysToStringList(validMetadataFlags))
+		badOptions = true
+	}
+
+	if _, ok := validHashFlags[o.HashAlgorithm]; !ok {
+		fmt.Println("--hash must be one of:", keysToStringList(validHashFlags))
+		badOptions = true
+	} else if o.TrustHash && !hashAlgorithms[o.HashAlgorithm].cryptographic {
+		fmt.Println("--trust-hash requires a cryptographic --hash, such as", HashSHA256)
+		badOptions = true
+	}
+
 	if err = o.parseMatchSpec(*matchSpec, o.Verb()); err != nil {
 		fmt.Println("Invalid --match parameter:", err)
 		badOptions = true
@@ -393,14 +757,6 @@ func (o *options) ParseArgs(args []string) (dirs []string) {
 	return fs.Args()
 }
 
-func globMatcher(pattern string) (matchers.Matcher, error) {
-	abs, err := filepath.Abs(pattern)
-	if err != nil {
-		return nil, fmt.Errorf("unable to resolve \"%s\": %w", pattern, err)
-	}
-	return glob.NewMatcher(abs)
-}
-
 func globMatcherFromDir(dir string) (matchers.Matcher, error) {
 	abs, err := filepath.Abs(dir)
 	if err != nil {
@@ -416,6 +772,15 @@ func globMatcherFromDir(dir string) (matchers.Matcher, error) {
 	return glob.NewMatcher(filepath.Join(abs, "**", "*"))
 }
 
+// quarantineMatcher matches the contents of the --move-to directory, which may not exist yet
+func quarantineMatcher(dir string) (matchers.Matcher, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve \"%s\": %w", dir, err)
+	}
+	return glob.NewMatcher(filepath.Join(abs, "**", "*"))
+}
+
 func (o *options) globPattern() string {
 	if o.Recursive {
 		return "./**/*"
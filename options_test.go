@@ -2,6 +2,7 @@ package main
 
 import (
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -34,6 +35,54 @@ func TestProtectArgs(t *testing.T) {
 	}
 }
 
+func TestOptions_PathMatchers(t *testing.T) {
+	assert := require.New(t)
+
+	args := []string{`fdf`, `-r`,
+		`--exclude`, `i:**/*.JPG`,
+		`--exclude-regex`, `^build/`,
+		`--include-regex`, `/build/keep\.`,
+		`--protect-regex`, `\.(?i:iso)$`,
+		`--if-kept`, `src/**/*`,
+		`--if-not-kept-regex`, `/old/`,
+	}
+	var o options
+	assert.Empty(o.ParseArgs(args))
+
+	root, err := filepath.Abs("root")
+	assert.NoError(err)
+	o.scanRoots = []string{root}
+	in := func(rel string) string {
+		return filepath.Join(root, filepath.FromSlash(rel))
+	}
+
+	for path, excluded := range map[string]bool{
+		in("a/photo.jpg"):      true,
+		in("a/PHOTO.Jpg"):      true,
+		in("a/photo.png"):      false,
+		in("build/x.o"):        true,
+		in("build/keep.o"):     false,
+		in("src/build/x.o"):    false,
+		"/elsewhere/build/x.o": false,
+	} {
+		assert.Equal(excluded, o.Exclude.Includes(path), path)
+	}
+
+	assert.True(o.Protect.Includes(in("a/disk.ISO")))
+	assert.False(o.Protect.Includes(in("a/disk.img")))
+
+	// Relative globs match relative to the working directory as well as the scanned directory
+	assert.True(o.MustKeep.Includes(in("src/main.go")))
+	wd, err := filepath.Abs("src/main.go")
+	assert.NoError(err)
+	assert.True(o.MustKeep.Includes(wd))
+	assert.False(o.MustKeep.Includes(in("src/old/main.go")))
+	assert.False(o.MustKeep.Includes(in("lib/main.go")))
+
+	_, err = o.regexMatcher("(")
+	assert.Error(err)
+}
+
 func TestOptions_ParseArgs(t *testing.T) {
 	assert := require.New(t)
 
@@ -76,3 +125,29 @@ func TestOptions_ParseArgs(t *testing.T) {
 		}
 	}
 }
+
+func TestOptions_VerbCount(t *testing.T) {
+	assert := require.New(t)
+
+	o := &options{MoveTo: "q"}
+	assert.Equal(1, o.verbCount())
+	assert.Equal(VerbMove, o.Verb())
+
+	// Verb precedence would otherwise select --delete
+	o.deleteDupes = true
+	assert.Equal(2, o.verbCount())
+	assert.Equal(VerbDelete, o.Verb())
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	assert := require.New(t)
+
+	assert.True(caseInsensitive(`i:**/*.JPG`))
+	assert.True(caseInsensitive(`i:photos/*.JPG`))
+	assert.False(caseInsensitive(`I:**/*.JPG`))
+	assert.False(caseInsensitive(`**/i:*.JPG`))
+
+	// Only Windows treats a separator after i: as the root of a drive
+	assert.Equal(runtime.GOOS != "windows", caseInsensitive(`i:\photos\*.jpg`))
+	assert.Equal(runtime.GOOS != "windows", caseInsensitive(`i:/photos/*.jpg`))
+}
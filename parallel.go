@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"sync"
+)
+
+// parallel calls fn for each index in [0, n), using at most options.Jobs
+// goroutines. Returns once every call has completed.
+func (t *fileTable) parallel(n int, fn func(i int)) {
+	jobs := t.options.Jobs
+	if jobs <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	if jobs > n {
+		jobs = n
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	wg.Add(jobs)
+	for w := 0; w < jobs; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// sortedRecords returns the contents of rs ordered by FilePath, so that
+// concurrent comparisons always resolve to the same match.
+func sortedRecords(rs recordSet) []*fileRecord {
+	list := make([]*fileRecord, 0, len(rs))
+	for r := range rs {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].FilePath < list[j].FilePath
+	})
+	return list
+}
+
+// hashAhead hashes records concurrently, ahead of their comparison by
+// findStat. As with checkCandidates, large files are only read in full
+// if another record shares their Prehash. Hardlinked records are only
+// hashed once, as findStat matches them without reading either.
+func (t *fileTable) hashAhead(records []*fileRecord) {
+	var distinct []*fileRecord
+	for _, r := range records {
+		linked := false
+		for _, d := range distinct {
+			if os.SameFile(r.FileInfo, d.FileInfo) {
+				linked = true
+				break
+			}
+		}
+		if !linked {
+			distinct = append(distinct, r)
+		}
+	}
+
+	prehashes := map[checksum]int{}
+	t.parallel(len(distinct), func(i int) {
+		if t.usePrehash(distinct[i]) {
+			t.Prehash(distinct[i], false)
+		}
+	})
+	for _, r := range distinct {
+		if r.HasPrehash {
+			prehashes[r.Prehash]++
+		}
+	}
+
+	var full []*fileRecord
+	for _, r := range distinct {
+		if !t.usePrehash(r) || (r.HasPrehash && prehashes[r.Prehash] > 1) {
+			full = append(full, r)
+		}
+	}
+	t.parallel(len(full), func(i int) {
+		t.Checksum(full[i], false)
+	})
+}
+
+// checkCandidatesParallel is equivalent to checkCandidates, but hashes
+// and compares the candidates concurrently.
+func (t *fileTable) checkCandidatesParallel(current *fileRecord, candidates recordSet) (other *fileRecord) {
+	// Copy the candidates, as hashing updates the underlying indexes
+	others := sortedRecords(candidates)
+
+	if t.usePrehash(current) {
+		all := append([]*fileRecord{current}, others...)
+		t.parallel(len(all), func(i int) {
+			t.Prehash(all[i], all[i] != current)
+		})
+
+		if !current.HasPrehash {
+			return nil
+		}
+
+		var samePrehash []*fileRecord
+		for _, o := range others {
+			if o.HasPrehash && o.Prehash == current.Prehash {
+				samePrehash = append(samePrehash, o)
+			}
+		}
+		if others = samePrehash; len(others) == 0 {
+			return nil
+		}
+	}
+
+	all := append([]*fileRecord{current}, others...)
+	t.parallel(len(all), func(i int) {
+		t.Checksum(all[i], all[i] != current)
+	})
+
+	if !current.HasChecksum {
+		// We might still find a hardlink match later, even without deep comparison
+		return nil
+	}
+
+	var sameHash []*fileRecord
+	for _, o := range others {
+		if o.HasChecksum && o.Checksum == current.Checksum {
+			sameHash = append(sameHash, o)
+		}
+	}
+
+	equal := make([]bool, len(sameHash))
+	t.parallel(len(sameHash), func(i int) {
+		equal[i] = equalContents(current, sameHash[i], t.options)
+	})
+
+	for i, ok := range equal {
+		if ok {
+			current.everMatchedContent = true
+			sameHash[i].everMatchedContent = true
+			return sameHash[i]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/josephvusich/go-matchers"
+	"github.com/mattn/go-zglob"
+)
+
+// Prefix of a glob pattern that matches case-insensitively, e.g.: i:**/*.JPG
+const caseInsensitivePrefix = "i:"
+
+// caseInsensitive returns true if pattern begins with caseInsensitivePrefix.
+// On Windows, i: followed by a path separator is the root of drive I: instead.
+func caseInsensitive(pattern string) bool {
+	if !strings.HasPrefix(pattern, caseInsensitivePrefix) {
+		return false
+	}
+	rest := pattern[len(caseInsensitivePrefix):]
+	return runtime.GOOS != "windows" || rest == "" || !os.IsPathSeparator(rest[0])
+}
+
+// pathMatcher matches the absolute path of each file, and for relative patterns,
+// also its path relative to any directory passed to scanner.Scan
+type pathMatcher struct {
+	pattern string
+	match   func(path string) bool
+
+	// Set for patterns that may match paths relative to a scanned directory
+	o *options
+}
+
+func (m *pathMatcher) Match(path string) bool {
+	if m.match(path) {
+		return true
+	}
+	if m.o == nil {
+		return false
+	}
+	for _, root := range m.o.scanRoots {
+		if rel, err := filepath.Rel(root, path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			if m.match(rel) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *pathMatcher) String() string {
+	return m.pattern
+}
+
+// globMatcher matches pattern against absolute paths, where a relative pattern is
+// taken relative to the working directory, and against paths relative to each
+// scanned directory. Patterns beginning with i: match case-insensitively.
+func (o *options) globMatcher(pattern string) (matchers.Matcher, error) {
+	raw := pattern
+	fold := caseInsensitive(pattern)
+	if fold {
+		pattern = pattern[len(caseInsensitivePrefix):]
+	}
+
+	abs, err := filepath.Abs(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve \"%s\": %w", raw, err)
+	}
+	rel := filepath.Clean(pattern)
+	if fold {
+		abs, rel = strings.ToLower(abs), strings.ToLower(rel)
+	}
+
+	m := &pathMatcher{
+		pattern: raw,
+		match: func(path string) bool {
+			if fold {
+				path = strings.ToLower(path)
+			}
+			p := abs
+			if !filepath.IsAbs(path) {
+				p = rel
+			}
+			ok, err := zglob.Match(p, path)
+			if err != nil {
+				panic(err)
+			}
+			return ok
+		},
+	}
+	if !filepath.IsAbs(pattern) {
+		m.o = o
+	}
+	return m, nil
+}
+
+// regexMatcher matches pattern anywhere within the absolute path of each file,
+// or its path relative to any scanned directory, using forward slashes on all platforms
+func (o *options) regexMatcher(pattern string) (matchers.Matcher, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &pathMatcher{
+		pattern: pattern,
+		match: func(path string) bool {
+			return re.MatchString(filepath.ToSlash(path))
+		},
+		o: o,
+	}, nil
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/josephvusich/go-getopt"
+)
+
+// Increment whenever the plan layout changes
+const planVersion = 1
+
+// plan is the --plan file, listing the actions chosen by a scan for 'fdf apply'
+type plan struct {
+	Version int `json:"version"`
+
+	// Options that affect how actions are carried out
+	Verb           string `json:"verb"`
+	Trash          bool   `json:"trash,omitempty"`
+	Symlink        string `json:"symlink,omitempty"`
+	MoveTo         string `json:"move_to,omitempty"`
+	MetadataPolicy string `json:"metadata"`
+	LinkMismatched bool   `json:"link_mismatched,omitempty"`
+	CopyUnlinked   bool   `json:"copy_unlinked,omitempty"`
+
+	// Options that affect checksum values
+	Algorithm  string `json:"hash"`
+	HashKey    []byte `json:"hash_key"`
+	SkipHeader int64  `json:"skip_header"`
+	SkipFooter int64  `json:"skip_footer"`
+
+	Actions []*planAction `json:"actions"`
+}
+
+type planAction struct {
+	Verb     string     `json:"verb"`
+	Match    matchFlag  `json:"match"`
+	Kept     planRecord `json:"kept"`
+	Replaced planRecord `json:"replaced"`
+}
+
+// planRecord identifies the exact file that an action was planned for
+type planRecord struct {
+	Path       string    `json:"path"`
+	PathSuffix string    `json:"path_suffix"`
+	Size       int64     `json:"size"`
+	Mtime      time.Time `json:"mtime"`
+	Dev        uint64    `json:"dev,omitempty"`
+	Ino        uint64    `json:"ino,omitempty"`
+	Checksum   string    `json:"checksum"`
+}
+
+func newPlan(o *options) *plan {
+	return &plan{
+		Version:        planVersion,
+		Verb:           verbNames[o.Verb()],
+		Trash:          o.Trash,
+		Symlink:        o.Symlink,
+		MoveTo:         o.MoveTo,
+		MetadataPolicy: o.MetadataPolicy,
+		LinkMismatched: o.LinkMismatched,
+		CopyUnlinked:   o.CopyUnlinked,
+		Algorithm:      o.hashAlgorithm(),
+		HashKey:        hashKey,
+		SkipHeader:     o.SkipHeader,
+		SkipFooter:     o.SkipFooter,
+		Actions:        []*planAction{},
+	}
+}
+
+// add records the replacement of current with match by verb,
+// checksumming both files so that apply can detect any changes
+func (p *plan) add(t *fileTable, v verb, match, current *fileRecord, m matchFlag) error {
+	if err := t.Checksum(match, true); err != nil {
+		return err
+	}
+	if err := t.Checksum(current, false); err != nil {
+		return err
+	}
+
+	p.Actions = append(p.Actions, &planAction{
+		Verb:     verbNames[v],
+		Match:    m,
+		Kept:     newPlanRecord(match, p.Algorithm),
+		Replaced: newPlanRecord(current, p.Algorithm),
+	})
+	return nil
+}
+
+func newPlanRecord(r *fileRecord, algorithm string) planRecord {
+	pr := planRecord{
+		Path:       r.FilePath,
+		PathSuffix: r.PathSuffix,
+		Size:       r.Size(),
+		Mtime:      r.ModTime(),
+		Checksum:   checksumHex(algorithm, r.Checksum),
+	}
+	if s, ok := getStatInfo(r.FileInfo); ok {
+		pr.Dev, pr.Ino = s.Dev, s.Ino
+	}
+	return pr
+}
+
+func (p *plan) Write(path string) error {
+	fmt.Printf("Writing %s...\n", path)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(p); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func readPlan(path string) (*plan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	p := &plan{}
+	if err = json.NewDecoder(f).Decode(p); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.Version != planVersion:
+		return nil, fmt.Errorf("unsupported version %d", p.Version)
+	case len(p.HashKey) != len(hashKey):
+		return nil, errors.New("invalid hash key")
+	}
+	if _, ok := validHashFlags[p.Algorithm]; !ok {
+		return nil, fmt.Errorf("unsupported hash %q", p.Algorithm)
+	}
+	if _, ok := validMetadataFlags[p.MetadataPolicy]; !ok {
+		return nil, fmt.Errorf("unsupported metadata policy %q", p.MetadataPolicy)
+	}
+	if _, ok := verbByName(p.Verb); !ok {
+		return nil, fmt.Errorf("unsupported verb %q", p.Verb)
+	}
+	for i, a := range p.Actions {
+		if _, ok := verbByName(a.Verb); !ok {
+			return nil, fmt.Errorf("action %d: unsupported verb %q", i+1, a.Verb)
+		}
+	}
+	return p, nil
+}
+
+func verbByName(name string) (verb, bool) {
+	for v, n := range verbNames {
+		if n == name {
+			return v, true
+		}
+	}
+	return VerbNone, false
+}
+
+// configure applies the options recorded by p to o, and adopts its hash key
+func (p *plan) configure(o *options) {
+	v, _ := verbByName(p.Verb)
+	o.Symlink = p.Symlink
+	o.setVerb(v)
+	o.Trash = p.Trash
+	o.MoveTo = p.MoveTo
+	o.MetadataPolicy = p.MetadataPolicy
+	o.LinkMismatched = p.LinkMismatched
+	o.CopyUnlinked = p.CopyUnlinked
+	o.HashAlgorithm = p.Algorithm
+	o.SkipHeader = p.SkipHeader
+	o.SkipFooter = p.SkipFooter
+	hashKey = p.HashKey
+}
+
+// apply carries out the actions of a --plan file, skipping any whose files
+// have changed since it was written, and returns the process exit code
+func apply(args []string) int {
+	fs := getopt.NewFlagSet("fdf apply", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage: fdf apply [--dry-run] [--journal FILE] PLAN\n\n")
+		fs.PrintDefaults()
+	}
+	f := newScanner()
+	fs.BoolVar(&f.options.DryRun, "dry-run", false, "don't actually do anything, just show what would be done")
+	fs.StringVar(&f.options.Journal, "journal", "", "append a record of every change to `FILE`, which can be reversed by 'fdf undo FILE'")
+	helpFlag := fs.Bool("help", false, "show this help screen and exit")
+	fs.Alias("h", "help")
+
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if *helpFlag {
+		fs.Usage()
+		return 0
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	p, err := readPlan(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("%s: %s\n", fs.Arg(0), err)
+		return 1
+	}
+	p.configure(&f.options)
+
+	if err = f.Apply(p); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	fmt.Printf("\n%s\n", f.totals.PrettyFormat(f.options.Verb()))
+	if count, _ := f.totals.Errors.Get(); count != 0 {
+		return 1
+	}
+	return 0
+}
+
+// Apply carries out the actions of p
+func (f *scanner) Apply(p *plan) error {
+	f.totals.Start()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	f.table.scanDir = wd
+
+	closeOutputs, err := f.openOutputs()
+	if err != nil {
+		return err
+	}
+	defer closeOutputs()
+
+	for _, a := range p.Actions {
+		f.applyAction(a)
+	}
+	return nil
+}
+
+func (f *scanner) applyAction(a *planAction) {
+	v, _ := verbByName(a.Verb)
+
+	match, err := f.table.reload(&a.Kept)
+	if err != nil {
+		fmt.Printf("  skip( %s ) %s\n", f.table.Rel(a.Replaced.Path), err)
+		f.totals.Changed.Add(nil)
+		return
+	}
+	current, err := f.table.reload(&a.Replaced)
+	if err != nil {
+		fmt.Printf("  skip( %s ) %s\n", f.table.Rel(a.Replaced.Path), err)
+		f.totals.Changed.Add(nil)
+		return
+	}
+
+	f.totals.Files.Add(current)
+	f.totals.category(a.Match).Add(current)
+	fmt.Printf("%s == %s (%s)\n", match.RelPath, current.RelPath, humanize.IBytes(uint64(current.Size())))
+	f.finish(current, f.act(v, match, current, a.Match))
+}
+
+// reload returns a new record for the file identified by pr,
+// or an error if it has changed since the plan was written
+func (t *fileTable) reload(pr *planRecord) (*fileRecord, error) {
+	st, err := os.Lstat(pr.Path)
+	if err != nil {
+		return nil, err
+	}
+	r := newFileRecord(pr.Path, st, t.Rel(pr.Path), pr.PathSuffix)
+
+	// Planned files are never symlinks, so one has replaced the file since
+	changed := errors.New("changed since it was planned")
+	if st.Mode()&os.ModeSymlink != 0 || st.Size() != pr.Size || !st.ModTime().Equal(pr.Mtime) {
+		return nil, changed
+	}
+	if s, ok := getStatInfo(st); ok && pr.Ino != 0 && (s.Dev != pr.Dev || s.Ino != pr.Ino) {
+		return nil, changed
+	}
+
+	if err = t.Checksum(r, false); err != nil {
+		return nil, err
+	}
+	if checksumHex(t.options.hashAlgorithm(), r.Checksum) != pr.Checksum {
+		return nil, changed
+	}
+	return r, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan_Apply(t *testing.T) {
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./d",
+		},
+		content: map[string]string{
+			"a": "foobar",
+			"b": "foobar",
+			"c": "foobar",
+			"x": "fizzbuzz",
+			"y": "fizzbuzz",
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		planDir, err := ioutil.TempDir("", "fdfplan")
+		assert.NoError(err)
+		defer os.RemoveAll(planDir)
+		planPath := filepath.Join(planDir, "plan.json")
+
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `--timestamps`, `ignore`, `--link`, `--plan`, planPath}))
+		assert.True(scanner.options.DryRun)
+		assert.NoError(scanner.Scan())
+		assert.Equal(uint64(0), scanner.totals.Processed.count)
+		assert.Equal(uint64(3), scanner.totals.Skipped.count)
+
+		p, err := readPlan(planPath)
+		assert.NoError(err)
+		assert.Len(p.Actions, 3)
+		assert.Equal(JournalLink, p.Verb)
+		for _, a := range p.Actions {
+			assert.Equal(JournalLink, a.Verb)
+			assert.NotEmpty(a.Kept.Checksum)
+			assert.Equal(a.Kept.Checksum, a.Replaced.Checksum)
+		}
+
+		// Nothing changed yet
+		validate(l)
+		for _, name := range []string{"d/b", "d/c", "d/y"} {
+			st, err := os.Stat(name)
+			assert.NoError(err)
+			assert.Equal(uint64(1), linkCount(st), name)
+		}
+
+		// Same size and timestamp, different contents
+		st, err := os.Stat("d/y")
+		assert.NoError(err)
+		assert.NoError(ioutil.WriteFile("d/y", []byte("fizzfizz"), 0666))
+		assert.NoError(os.Chtimes("d/y", st.ModTime(), st.ModTime()))
+
+		assert.Equal(0, apply([]string{planPath}))
+
+		a, err := os.Stat("d/a")
+		assert.NoError(err)
+		for _, name := range []string{"d/b", "d/c"} {
+			st, err := os.Stat(name)
+			assert.NoError(err)
+			assert.True(os.SameFile(a, st), name)
+		}
+
+		x, err := os.Stat("d/x")
+		assert.NoError(err)
+		y, err := os.Stat("d/y")
+		assert.NoError(err)
+		assert.False(os.SameFile(x, y))
+		b, err := ioutil.ReadFile("d/y")
+		assert.NoError(err)
+		assert.Equal("fizzfizz", string(b))
+	})
+}
+
+func linkCount(st os.FileInfo) uint64 {
+	s, ok := getStatInfo(st)
+	if !ok {
+		return 1
+	}
+	return s.Nlink
+}
+
+func TestPlan_ApplyLinkMismatched(t *testing.T) {
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./d",
+		},
+		content: map[string]string{
+			"a": "foobar",
+			"b": "foobar",
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		planDir, err := ioutil.TempDir("", "fdfplan")
+		assert.NoError(err)
+		defer os.RemoveAll(planDir)
+		planPath := filepath.Join(planDir, "plan.json")
+
+		assert.NoError(os.Chmod("d/b", 0600))
+
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `--timestamps`, `ignore`, `--auto`, `--link-mismatched`, `--plan`, planPath}))
+		assert.NoError(scanner.Scan())
+
+		p, err := readPlan(planPath)
+		assert.NoError(err)
+		assert.Len(p.Actions, 1)
+		assert.True(p.LinkMismatched)
+
+		// Restored by apply, which would otherwise skip the mismatched pair
+		o := &options{}
+		p.configure(o)
+		assert.True(o.LinkMismatched)
+
+		assert.Equal(0, apply([]string{planPath}))
+		if !probeDevice("d").clone {
+			a, err := os.Stat("d/a")
+			assert.NoError(err)
+			b, err := os.Stat("d/b")
+			assert.NoError(err)
+			assert.True(os.SameFile(a, b))
+		}
+	})
+}
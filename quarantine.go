@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/josephvusich/fdf/report"
+)
+
+// Name of the manifest written to the --move-to directory
+const quarantineManifest = "fdf-manifest.jsonl"
+
+// quarantine moves duplicates into the --move-to directory,
+// mirroring their paths relative to the scan root
+type quarantine struct {
+	dir string
+
+	mutex    sync.Mutex
+	manifest *os.File
+}
+
+func newQuarantine(dir string) (*quarantine, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve \"%s\": %w", dir, err)
+	}
+	return &quarantine{dir: abs}, nil
+}
+
+// target returns the preferred destination of r, ignoring any collisions
+func (q *quarantine) target(r *fileRecord) string {
+	return filepath.Join(q.dir, r.PathSuffix, filepath.Base(r.FilePath))
+}
+
+// reserve creates an empty placeholder at an unused destination for r, see reserveName
+func (q *quarantine) reserve(r *fileRecord) (string, error) {
+	dst := q.target(r)
+	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+		return "", err
+	}
+	return reserveName(dst, createExclusive)
+}
+
+// move relocates r to dst, which must have been returned by reserve.
+// The move is recorded in the manifest before r is touched, so that
+// an interrupted run still leaves a record of where r may be found.
+func (q *quarantine) move(r, kept *fileRecord, dst string) error {
+	m := &report.Move{
+		Time:     time.Now(),
+		Original: r.FilePath,
+		Moved:    dst,
+		Kept:     kept.FilePath,
+		Size:     r.Size(),
+		Status:   report.MovePending,
+	}
+	if err := q.record(m, true); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	err := os.Rename(r.FilePath, dst)
+	if errors.Is(err, syscall.EXDEV) {
+		err = moveAcrossDevices(r.FilePath, dst)
+	}
+
+	m.Time = time.Now()
+	m.Status = report.MoveDone
+	if err != nil {
+		os.Remove(dst)
+		m.Status = report.MoveFailed
+	}
+	if rerr := q.record(m, false); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// moveAcrossDevices copies src to dst with its metadata, then removes src.
+// The copy is written to a temporary name, then renamed over the placeholder
+// left by reserve, as some platforms refuse to copy onto an existing file.
+func moveAcrossDevices(src, dst string) error {
+	m, err := readMetadata(src)
+	if err != nil {
+		return err
+	}
+	tmp, err := tempName(dst)
+	if err != nil {
+		return err
+	}
+	if err = copyFile(src, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = m.apply(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// record appends m to the manifest, flushing it to disk if sync is true
+func (q *quarantine) record(m *report.Move, sync bool) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.manifest == nil {
+		f, err := os.OpenFile(filepath.Join(q.dir, quarantineManifest), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			return fmt.Errorf("unable to open manifest: %w", err)
+		}
+		q.manifest = f
+	}
+
+	if err := json.NewEncoder(q.manifest).Encode(m); err != nil {
+		return fmt.Errorf("unable to write manifest: %w", err)
+	}
+	if sync {
+		if err := q.manifest.Sync(); err != nil {
+			return fmt.Errorf("unable to write manifest: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close closes the manifest, if any moves were recorded
+func (q *quarantine) Close() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.manifest == nil {
+		return nil
+	}
+	err := q.manifest.Close()
+	q.manifest = nil
+	return err
+}
@@ -8,7 +8,7 @@ import (
 	"github.com/josephvusich/fdf/report"
 )
 
-func writeReport(path string, pairs, namePairs [][]string, db *db) error {
+func writeReport(path string, pairs, namePairs [][]string, db *db, filters *report.Filters, audit *symlinkAudit) error {
 	if path == "" {
 		return nil
 	}
@@ -32,10 +32,16 @@ func writeReport(path string, pairs, namePairs [][]string, db *db) error {
 	}
 	defer f.Close()
 
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	return enc.Encode(&report.Report{
+	r := &report.Report{
 		ContentMatches: pairs,
 		NameMatches:    namePairs,
-	})
+		Filters:        filters,
+	}
+	if audit != nil {
+		r.Symlinks = audit.Report()
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
 }
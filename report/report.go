@@ -1,7 +1,61 @@
 package report
 
+import "time"
+
 type Report struct {
 	ContentMatches [][]string `json:"content_matches"`
 	NameMatches    [][]string `json:"name_matches"`
 	Unmatched      []string   `json:"unmatched"`
+
+	// Size and time filters that were active during the scan
+	Filters *Filters `json:"filters"`
+
+	// Populated by --symlink-audit
+	Symlinks *Symlinks `json:"symlinks,omitempty"`
+}
+
+// Filters lists the size and time filters applied to every scanned file
+type Filters struct {
+	MinimumSize int64      `json:"minimum_size"`
+	MaximumSize int64      `json:"maximum_size,omitempty"`
+	NewerThan   *time.Time `json:"newer_than,omitempty"`
+	OlderThan   *time.Time `json:"older_than,omitempty"`
+
+	// Field compared by NewerThan and OlderThan, either mtime or ctime
+	TimeField string `json:"time_field,omitempty"`
+}
+
+// Symlinks lists groups of symlinks found by --symlink-audit. Each group
+// begins with the shared target or link text, followed by the link paths.
+type Symlinks struct {
+	SameTarget [][]string `json:"same_target"`
+	SameText   [][]string `json:"same_text"`
+	Broken     []string   `json:"broken"`
 }
+
+// Move is a single line of the manifest written by --move-to
+type Move struct {
+	Time time.Time `json:"time"`
+
+	// Absolute path of the duplicate before it was moved
+	Original string `json:"original"`
+
+	// Absolute path of the duplicate within the --move-to directory
+	Moved string `json:"moved"`
+
+	// Absolute path of the matching file that was kept in place
+	Kept string `json:"kept"`
+
+	Size int64 `json:"size"`
+
+	// MovePending, MoveDone, or MoveFailed
+	Status string `json:"status"`
+}
+
+// Each move is recorded as pending before the file is moved,
+// then again as moved or failed once the outcome is known
+const (
+	MovePending = "pending"
+	MoveDone    = "moved"
+	MoveFailed  = "failed"
+)
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// reserveName calls create with name, appending " (N)" before its extension to
+// resolve collisions, until create succeeds or fails with an error other than
+// os.ErrExist. Returns the name accepted by create.
+func reserveName(name string, create func(name string) error) (string, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		err := create(name)
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+		name = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+	}
+}
+
+// createExclusive creates an empty file at path, failing with os.ErrExist if it exists
+func createExclusive(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
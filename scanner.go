@@ -25,6 +25,40 @@ type scanner struct {
 	table   *fileTable
 	options options
 	totals  totals
+
+	// Destination of --move-to, nil otherwise
+	quarantine *quarantine
+
+	// Destination of --delete --trash, nil otherwise
+	trash *trash
+
+	// Record of every action taken, nil unless --journal is specified
+	journal *journal
+
+	// Actions to be taken by apply, nil unless --plan is specified
+	plan *plan
+
+	// Shell equivalent of each action, nil unless --script is specified
+	script *script
+
+	// Files bucketed by index key during the first phase of --two-phase
+	pending      map[query][]*pendingFile
+	pendingOrder []query
+
+	// Symlinks deferred by --follow-symlinks until every directory has been walked
+	links []*pendingFile
+
+	// Directories and files already walked, for --follow-symlinks
+	visited map[fileKey]struct{}
+
+	// Symlinks grouped by target, nil unless --symlink-audit is specified
+	audit *symlinkAudit
+
+	// Device of each scanned directory, for --one-file-system
+	rootDevs map[string]uint64
+
+	// Rules of the ignore files read from each walked directory
+	ignores map[string][]*ignoreRule
 }
 
 func newScanner() *scanner {
@@ -34,8 +68,8 @@ func newScanner() *scanner {
 	return s
 }
 
-// Don't display warnings for these dotfiles
-var silentSkip = map[string]struct{}{
+// Always skipped without a warning, in addition to any --silent-skip names
+var defaultSilentSkip = nameSet{
 	".DS_Store":               {},
 	".DocumentRevisions-V100": {},
 	".Spotlight-V100":         {},
@@ -53,6 +87,16 @@ func (f *scanner) Scan(dirs ...string) (err error) {
 	}
 	f.totals.Start()
 
+	if f.options.CacheFile != "" && f.table.cache == nil {
+		f.table.cache = loadChecksumCache(f.options.CacheFile, &f.options)
+	}
+
+	closeOutputs, err := f.openOutputs()
+	if err != nil {
+		return err
+	}
+	defer closeOutputs()
+
 	wd, err := os.Getwd()
 	if err != nil {
 		return err
@@ -62,9 +106,14 @@ func (f *scanner) Scan(dirs ...string) (err error) {
 		dirs = []string{wd}
 	}
 
+	f.options.scanRoots = f.options.scanRoots[:0]
 	for _, d := range dirs {
-		suffixes := map[string]string{}
+		if abs, err := filepath.Abs(d); err == nil {
+			f.options.scanRoots = append(f.options.scanRoots, abs)
+		}
+	}
 
+	for _, d := range dirs {
 		if f.table.scanDir, err = filepath.Abs(d); err != nil {
 			return fmt.Errorf("unable to resolve \"%s\": %w", d, err)
 		}
@@ -72,48 +121,71 @@ func (f *scanner) Scan(dirs ...string) (err error) {
 			f.table.relDir = f.table.scanDir
 		}
 
-		if err = filepath.Walk(f.table.scanDir, func(path string, info os.FileInfo, inErr error) error {
-			pathSuffix := ""
-			if info != nil && !info.IsDir() {
-				dir := filepath.Dir(path)
-				suffix, ok := suffixes[dir]
-				if !ok {
-					suffix, err = filepath.Rel(f.table.scanDir, dir)
-					if err != nil {
-						suffix = dir
-					}
-					suffixes[dir] = suffix
-				}
-				pathSuffix = suffix
-			}
-			return f.walkFunc(path, pathSuffix, info, inErr)
-		}); err != nil {
+		if err = f.walk(f.table.scanDir, ""); err != nil {
 			return err
 		}
 	}
 
+	if err = f.followSymlinks(); err != nil {
+		return err
+	}
+
+	if f.options.twoPhase() {
+		f.processPending()
+	}
+
+	if f.audit != nil {
+		f.auditSymlinks()
+	}
+
+	if f.plan != nil {
+		if err = f.plan.Write(f.options.PlanFile); err != nil {
+			return fmt.Errorf("unable to write plan: %w", err)
+		}
+	}
+
+	if f.script != nil {
+		if err = f.script.Write(f.options.ScriptFile, &f.totals, f.options.Verb()); err != nil {
+			return fmt.Errorf("unable to write script: %w", err)
+		}
+	}
+
+	if f.table.cache != nil {
+		if err := f.table.cache.Save(); err != nil {
+			fmt.Printf("%s: unable to write checksum cache: %s\n", f.options.CacheFile, err)
+		}
+	}
+
 	return nil
 }
 
 func (f *scanner) walkFunc(path, pathSuffix string, info os.FileInfo, inErr error) error {
-	if info == nil {
+	if info == nil && path == f.table.scanDir {
 		return fmt.Errorf("unable to stat: %s", path)
 	}
+	if inErr != nil {
+		fmt.Printf("%s: %s\n", path, inErr)
+		f.totals.Errors.Add(nil)
+		return nil
+	}
 	typ := info.Mode()
 	base := filepath.Base(path)
 
-	if base[0] == '.' || inErr != nil {
-		_, silent := silentSkip[base]
-		if !silent {
-			if inErr != nil {
-				fmt.Printf("%s: %s\n", path, inErr)
-				return nil
-			}
-			if f.options.Verbose {
-				fmt.Printf("%s: skipping dot-prefix\n", path)
-			}
+	skip := f.options.silentSkip(base) || (!typ.IsDir() && f.options.isIgnoreFile(base))
+	if !skip && base[0] == '.' && path != f.table.scanDir && !f.options.includeHidden(typ) {
+		if f.options.Verbose {
+			fmt.Printf("%s: skipping dot-prefix\n", path)
 		}
-		if inErr == nil && typ.IsDir() {
+		skip = true
+	}
+	if !skip && path != f.table.scanDir && f.ignored(path, typ.IsDir()) {
+		if f.options.Verbose {
+			fmt.Printf("%s: skipping, ignored\n", path)
+		}
+		skip = true
+	}
+	if skip {
+		if typ.IsDir() {
 			return filepath.SkipDir
 		}
 		return nil
@@ -128,20 +200,162 @@ func (f *scanner) walkFunc(path, pathSuffix string, info os.FileInfo, inErr erro
 		return filepath.SkipDir
 	}
 
+	if path != f.table.scanDir && f.skipTraversal(path, info) {
+		if typ.IsDir() {
+			f.totals.Traversal.Add(nil)
+			return filepath.SkipDir
+		}
+		f.totals.Traversal.Add(newFileRecord(path, info, "", pathSuffix))
+		return nil
+	}
+
+	if typ.IsDir() {
+		if err := f.loadIgnores(path); err != nil {
+			fmt.Printf("%s, skipping directory\n", err)
+			f.totals.Errors.Add(nil)
+			return filepath.SkipDir
+		}
+	}
+
 	if typ&os.ModeSymlink != 0 {
+		if f.audit != nil && !f.options.Exclude.Includes(path) {
+			if err := f.audit.add(f.table, path); err != nil {
+				fmt.Printf("%s: %s\n", path, err)
+				f.totals.Errors.Add(nil)
+			}
+		}
+		if f.options.FollowSymlinks {
+			f.links = append(f.links, &pendingFile{
+				path:       path,
+				pathSuffix: pathSuffix,
+				scanDir:    f.table.scanDir,
+				relDir:     f.table.relDir,
+			})
+			return nil
+		}
 		if typ.IsDir() {
 			return filepath.SkipDir
 		}
 		return nil
 	}
 
+	if f.options.twoPhase() {
+		f.enqueue(path, pathSuffix, info)
+		return nil
+	}
+
+	f.process(path, pathSuffix)
+	return nil
+}
+
+// skipTraversal returns true if path is outside of the limits set by
+// --one-file-system, --max-depth, and --min-depth for the current scan root
+func (f *scanner) skipTraversal(path string, info os.FileInfo) bool {
+	if f.options.OneFileSystem {
+		if s, ok := getStatInfo(info); ok && s.Dev != f.rootDev() {
+			if f.options.Verbose {
+				fmt.Printf("%s: skipping, on a different filesystem\n", path)
+			}
+			return true
+		}
+	}
+
+	if f.options.MaxDepth == 0 && f.options.MinDepth == 0 {
+		return false
+	}
+	rel, err := filepath.Rel(f.table.scanDir, path)
+	if err != nil {
+		return false
+	}
+	depth := strings.Count(rel, string(filepath.Separator)) + 1
+
+	// Directories are traversed up to --max-depth, as they may contain files deeper than --min-depth
+	if info.IsDir() {
+		return f.options.MaxDepth != 0 && depth >= f.options.MaxDepth
+	}
+	return (f.options.MaxDepth != 0 && depth > f.options.MaxDepth) || depth < f.options.MinDepth
+}
+
+// rootDev returns the device of the directory currently being scanned
+func (f *scanner) rootDev() uint64 {
+	dev, ok := f.rootDevs[f.table.scanDir]
+	if !ok {
+		if st, err := os.Stat(f.table.scanDir); err == nil {
+			s, _ := getStatInfo(st)
+			dev = s.Dev
+		}
+		if f.rootDevs == nil {
+			f.rootDevs = make(map[string]uint64)
+		}
+		f.rootDevs[f.table.scanDir] = dev
+	}
+	return dev
+}
+
+// openOutputs prepares the destinations used by the selected verb, --journal, and --plan.
+// The returned function must be called once all actions are complete.
+func (f *scanner) openOutputs() (closeOutputs func(), err error) {
+	if f.options.PlanFile != "" && f.plan == nil {
+		f.plan = newPlan(&f.options)
+	}
+
+	if f.options.ScriptFile != "" && f.script == nil {
+		f.script = &script{}
+	}
+
+	if f.options.AuditSymlinks && f.audit == nil {
+		f.audit = newSymlinkAudit()
+	}
+
+	if f.options.Journal != "" && f.journal == nil && !f.options.DryRun {
+		if f.journal, err = openJournal(f.options.Journal); err != nil {
+			return nil, fmt.Errorf("unable to open journal: %w", err)
+		}
+	}
+
+	if f.options.Trash && f.trash == nil {
+		f.trash = newTrash()
+	}
+
+	if f.options.MoveTo != "" && f.quarantine == nil {
+		if f.quarantine, err = newQuarantine(f.options.MoveTo); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() {
+		if f.journal != nil {
+			if err := f.journal.Close(); err != nil {
+				fmt.Printf("%s: %s\n", f.options.Journal, err)
+			}
+			f.journal = nil
+		}
+
+		if f.quarantine != nil {
+			if err := f.quarantine.Close(); err != nil {
+				fmt.Printf("%s: %s\n", f.options.MoveTo, err)
+			}
+		}
+	}, nil
+}
+
+// process matches a single file against the table and applies the selected verb
+func (f *scanner) process(path, pathSuffix string) {
 	current, err := f.execute(path, pathSuffix)
+	f.finish(current, err)
+}
+
+// finish reports the outcome of an action on current, and updates totals accordingly
+func (f *scanner) finish(current *fileRecord, err error) {
 	if err == nil {
 		fmt.Printf(" success\n")
 		f.totals.Processed.Add(current)
-	} else if err == noErrDryRun || err == fileIsSkipped {
-		if err == noErrDryRun {
-			fmt.Printf(" skipped\n")
+	} else if err == errNewLinkGroup {
+		fmt.Printf(" %s\n", err)
+		f.totals.LinkGroups.Add(current)
+	} else if err == noErrDryRun || err == noErrPlanned || err == noErrScripted || err == fileIsSkipped {
+		if err != fileIsSkipped {
+			fmt.Printf(" %s\n", err)
 		}
 		f.totals.Skipped.Add(current)
 	} else if err != fileIsIgnored {
@@ -152,8 +366,6 @@ func (f *scanner) walkFunc(path, pathSuffix string, info os.FileInfo, inErr erro
 			fmt.Println(err)
 		}
 	}
-
-	return nil
 }
 
 var (
@@ -161,8 +373,21 @@ var (
 	// Files skipped for other reasons should use fileIsSkipped
 	// Unlike fileIsSkipped, noErrDryRun displays the filepath along with "skipped"
 	noErrDryRun = errors.New("skipped")
+
+	// Used in place of noErrDryRun when the action was added to --plan
+	noErrPlanned = errors.New("planned")
+
+	// Used in place of noErrDryRun when the action was added to --script
+	noErrScripted = errors.New("scripted")
+
+	// Returned when a kept file reaches the hardlink limit of its filesystem,
+	// and the current file is kept in its place for subsequent matches
+	errNewLinkGroup = errors.New("link limit reached, kept as new link group")
 )
 
+// Replaced in tests to simulate filesystem limits
+var linkFile = os.Link
+
 // selectAndSwap returns true if current should be kept, replacing match,
 // based on protection status and filename preferences. Returns an error
 // if both records are protected.
@@ -179,7 +404,7 @@ func (f *scanner) selectAndSwap(current, match *fileRecord, m matchFlag) (swapMa
 		fmt.Printf("    skip( %s ) protected\n", match.RelPath)
 	}
 
-	canSwap := !matchProtected && currentCanBeKept
+	canSwap := !matchProtected && currentCanBeKept && !match.symlinked
 	canAvoidSwap := !currentProtected && matchCanBeKept
 
 	if canSwap != canAvoidSwap {
@@ -237,20 +462,32 @@ func (f *scanner) execute(path, pathSuffix string) (current *fileRecord, err err
 	}
 
 	comparison := "=="
+	f.totals.category(m).Add(current)
 	if m.has(matchHardlink) {
-		f.totals.Links.Add(current)
 		if f.options.IgnoreExistingLinks {
 			return current, fileIsIgnored
 		}
 		comparison = "<=>"
-	} else {
-		f.totals.Dupes.Add(current)
+	} else if m.has(matchClone) {
+		comparison = "<~>"
+	} else if m.has(matchPartial) {
+		comparison = "<~="
 	}
 
 	if f.options.Verbose || !current.Protect(&f.options.Protect) || !match.Protect(&f.options.Protect) {
 		fmt.Printf("%s %s %s (%s)\n", match.RelPath, comparison, current.RelPath, humanize.IBytes(uint64(current.Size())))
 	}
 
+	if m.has(matchCrossDev) {
+		fmt.Printf("  skip( %s ) on a different device\n", current.RelPath)
+		return current, fileIsSkipped
+	}
+
+	if m.has(matchMismatch) {
+		fmt.Printf("  skip( %s ) owner or permissions differ\n", current.RelPath)
+		return current, fileIsSkipped
+	}
+
 	verb := f.options.Verb()
 	if verb == VerbNone {
 		return current, fileIsIgnored
@@ -270,49 +507,184 @@ func (f *scanner) execute(path, pathSuffix string) (current *fileRecord, err err
 		match, current = current, match
 	}
 
+	return current, f.act(verb, match, current, m)
+}
+
+// act applies verb to current, replacing it with match where applicable
+func (f *scanner) act(verb verb, match, current *fileRecord, m matchFlag) (err error) {
 	f.Mutex.Destructive.RLock()
 	defer f.Mutex.Destructive.RUnlock()
 
-	// TODO handle uid and gid and perms
+	if verb == VerbAuto {
+		if m.has(matchHardlink) || m.has(matchClone) {
+			return fileIsIgnored
+		}
+		if verb, err = f.autoVerb(match, current, m); err != nil {
+			return err
+		}
+	}
+
+	// Journaled as pending by perform, immediately before it acts
+	var e *journalEntry
+	if f.journal != nil {
+		if e, err = f.newJournalEntry(verb, match, current); err != nil {
+			return err
+		}
+	}
+
+	moved, err := f.perform(verb, match, current, m, e)
+	if err == noErrDryRun && f.plan != nil {
+		if err = f.plan.add(f.table, verb, match, current, m); err != nil {
+			return err
+		}
+		return noErrPlanned
+	}
+	if err == noErrDryRun && f.script != nil {
+		if err = f.script.add(&f.options, f.quarantine, verb, match, current); err != nil {
+			return err
+		}
+		return noErrScripted
+	}
+	if e != nil && e.Status == JournalPending {
+		if jerr := f.journal.complete(e, moved, err); jerr != nil && err == nil {
+			err = fmt.Errorf("unable to write journal: %w", jerr)
+		}
+	}
+	return err
+}
+
+// perform carries out a single action of act. For actions that relocate
+// current rather than removing it, moved is its new path. If e is not nil,
+// it is journaled as pending before any change is made.
+func (f *scanner) perform(verb verb, match, current *fileRecord, m matchFlag, e *journalEntry) (moved string, err error) {
 	switch verb {
 	case VerbDelete:
-		fmt.Printf("  delete( %s )", current.RelPath)
+		if f.options.Trash {
+			fmt.Printf("  trash( %s )", current.RelPath)
+		} else {
+			fmt.Printf("  delete( %s )", current.RelPath)
+		}
 		if f.options.DryRun {
-			return current, noErrDryRun
+			return "", noErrDryRun
+		}
+		if f.options.Trash {
+			moved, err = f.trash.put(current.FilePath, func(dst string) error {
+				return f.intend(e, dst)
+			})
+		} else if err = f.intend(e, ""); err == nil {
+			err = os.Remove(current.FilePath)
 		}
-		err = os.Remove(current.FilePath)
 		if err == nil {
-			if m.has(matchHardlink) {
-				f.totals.Links.Remove(current)
-			} else {
-				f.totals.Dupes.Remove(current)
+			f.totals.category(m).Remove(current)
+		}
+		return moved, err
+	case VerbMove:
+		if f.options.DryRun {
+			fmt.Printf("  move( %s => %s )", current.RelPath, f.table.Rel(f.quarantine.target(current)))
+			return "", noErrDryRun
+		}
+		dst, err := f.quarantine.reserve(current)
+		if err != nil {
+			return "", err
+		}
+		fmt.Printf("  move( %s => %s )", current.RelPath, f.table.Rel(dst))
+		if err = f.intend(e, dst); err != nil {
+			os.Remove(dst)
+			return "", err
+		}
+		if err = f.quarantine.move(current, match, dst); err == nil {
+			f.totals.category(m).Remove(current)
+		}
+		return dst, err
+	case VerbDedupe:
+		if m.has(matchHardlink) || m.has(matchClone) {
+			return "", fileIsIgnored
+		}
+		fmt.Printf("  dedupe( %s => %s )", match.RelPath, current.RelPath)
+		if f.options.DryRun {
+			return "", noErrDryRun
+		}
+		if err := f.intend(e, ""); err != nil {
+			return "", err
+		}
+		deduped, err := dedupeFile(match.FilePath, current.FilePath)
+		if err != nil {
+			if deduped > 0 {
+				f.totals.category(m).Remove(current)
+				f.totals.Partial.Add(current)
+				err = fmt.Errorf("%w after %s", err, humanize.IBytes(uint64(deduped)))
 			}
+			return "", err
 		}
-		return current, err
-	case VerbClone, VerbMakeLinks, VerbSplitLinks:
+		f.totals.category(m).Remove(current)
+		f.totals.Cloned.Add(match)
+		return "", nil
+	case VerbAuto:
+		// Only under --dry-run, where the device has not been probed
+		fmt.Printf("  auto( %s => %s )", match.RelPath, current.RelPath)
+		return "", noErrDryRun
+	case VerbClone, VerbMakeLinks, VerbSplitLinks, VerbSymlink:
 		x := "clone"
 		a := cloneFile
+		if verb == VerbClone {
+			if m.has(matchClone) {
+				return "", fileIsIgnored
+			}
+			if !f.options.DryRun && !f.table.devices.caps(current).clone {
+				fmt.Printf("  skip( %s ) clones not supported\n", current.RelPath)
+				return "", fileIsSkipped
+			}
+		}
 		if verb == VerbMakeLinks {
 			if m.has(matchHardlink) {
-				return current, fileIsIgnored
+				return "", fileIsIgnored
 			}
 			x = "hardlink"
-			a = os.Link
+			a = linkFile
+			if !f.options.DryRun && !f.table.devices.caps(current).link {
+				fmt.Printf("  skip( %s ) hardlinks not supported\n", current.RelPath)
+				return "", fileIsSkipped
+			}
 		} else if verb == VerbSplitLinks {
 			if !m.has(matchHardlink) && !f.options.CopyUnlinked {
-				return current, fileIsIgnored
+				return "", fileIsIgnored
 			}
 			x = "copy"
 			a = copyFile
+		} else if verb == VerbSymlink {
+			if m.has(matchHardlink) || m.has(matchClone) {
+				return "", fileIsIgnored
+			}
+			// Never link to a file that may itself be replaced or retargeted
+			if st, err := os.Lstat(match.FilePath); err != nil {
+				return "", err
+			} else if st.Mode()&os.ModeSymlink != 0 {
+				fmt.Printf("  skip( %s ) kept file is a symlink\n", current.RelPath)
+				return "", fileIsSkipped
+			}
+			target, err := symlinkTarget(match.FilePath, current.FilePath, f.options.Symlink)
+			if err != nil {
+				return "", err
+			}
+			x = "symlink"
+			a = func(_, dst string) error {
+				return os.Symlink(target, dst)
+			}
 		}
 		fmt.Printf("  %s( %s => %s )", x, match.RelPath, current.RelPath)
 		if f.options.DryRun {
-			return current, noErrDryRun
+			if verb == VerbSymlink {
+				match.symlinked = true
+			}
+			return "", noErrDryRun
+		}
+		if err := f.intend(e, ""); err != nil {
+			return "", err
 		}
 		for retry := 0; retry < 3; retry++ {
-			tmp, err := tempName(current)
+			tmp, err := tempName(current.FilePath)
 			if err != nil {
-				return current, err
+				return "", err
 			}
 
 			if err = a(match.FilePath, tmp); err != nil {
@@ -320,35 +692,69 @@ func (f *scanner) execute(path, pathSuffix string) (current *fileRecord, err err
 					continue
 				}
 				os.Remove(tmp)
-				return current, fmt.Errorf("%s: %w", f.table.Rel(tmp), err)
+				if verb == VerbMakeLinks && errors.Is(err, syscall.EMLINK) && current.SatisfiesKept(&f.options.MustKeep) {
+					f.table.db.remove(match)
+					f.table.db.insert(current)
+					return "", errNewLinkGroup
+				}
+				return "", fmt.Errorf("%s: %w", f.table.Rel(tmp), err)
+			}
+
+			// Hardlinks share metadata with the kept file, and symlinks have none of their own
+			if verb != VerbMakeLinks && verb != VerbSymlink {
+				if err = f.options.copyMetadata(match, current, tmp); err != nil {
+					os.Remove(tmp)
+					return "", fmt.Errorf("%s: %w", f.table.Rel(tmp), err)
+				}
 			}
 
 			if err = os.Rename(tmp, current.FilePath); err == nil {
+				f.totals.category(m).Remove(current)
 				switch verb {
 				case VerbMakeLinks:
-					f.totals.Dupes.Remove(current)
 					f.totals.Links.Add(match)
 				case VerbSplitLinks:
-					f.totals.Links.Remove(current)
 					f.totals.Dupes.Add(current)
 				case VerbClone:
-					if m.has(matchHardlink) {
-						f.totals.Links.Remove(current)
-					} else {
-						f.totals.Dupes.Remove(current)
-					}
 					f.totals.Cloned.Add(match)
+				case VerbSymlink:
+					match.symlinked = true
 				}
 			}
-			return current, err
+			return "", err
 		}
 	}
 
-	return current, fileIsIgnored
+	return "", fileIsIgnored
+}
+
+// autoVerb selects the verb used by --auto for replacing current with match,
+// based on the capabilities of the filesystem containing both files
+func (f *scanner) autoVerb(match, current *fileRecord, m matchFlag) (verb, error) {
+	// Probing writes to the device, so leave the choice to apply or the script
+	if f.options.DryRun {
+		return VerbAuto, nil
+	}
+
+	c := f.table.devices.caps(current)
+	switch {
+	case c.clone:
+		return VerbClone, nil
+	case !c.link:
+		fmt.Printf("  skip( %s ) clones and hardlinks not supported\n", current.RelPath)
+		return VerbNone, fileIsSkipped
+	case !f.options.LinkMismatched && !sameOwnerAndMode(match, current):
+		f.totals.category(m).Remove(current)
+		f.totals.Mismatched.Add(current)
+		fmt.Printf("  skip( %s ) owner or permissions differ\n", current.RelPath)
+		return VerbNone, fileIsSkipped
+	}
+	return VerbMakeLinks, nil
 }
 
-func tempName(r *fileRecord) (string, error) {
-	dir := filepath.Dir(r.FilePath)
+// tempName returns an unused name in the directory of path
+func tempName(path string) (string, error) {
+	dir := filepath.Dir(path)
 	if dir == "" {
 		dir = "."
 	}
@@ -372,13 +778,37 @@ type totals struct {
 
 	Files  total
 	Unique total
+
+	// Files and directories excluded by --one-file-system, --max-depth, or --min-depth
+	Traversal total
+
 	Dupes  total
 	Cloned total
 	Links  total
 
+	// Duplicates sharing only some of their extents with a match
+	Partial total
+
+	// Duplicates that --link will not merge due to differing owners or permissions
+	Mismatched total
+
+	// Duplicates on a different device than any kept match
+	CrossDevice total
+
 	Processed total
 	Skipped   total
 	Errors    total
+
+	// Duplicates kept in place of a file that reached the hardlink limit
+	LinkGroups total
+
+	// Actions not applied because their files changed after --plan
+	Changed total
+
+	// Symlinks found by --symlink-audit, other than the first link to each target
+	RedundantLinks total
+	BrokenLinks    total
+	PrunedLinks    total
 }
 
 type total struct {
@@ -386,6 +816,23 @@ type total struct {
 	size  uint64
 }
 
+// category returns the total that a matched file is counted under
+func (t *totals) category(m matchFlag) *total {
+	switch {
+	case m.has(matchCrossDev):
+		return &t.CrossDevice
+	case m.has(matchMismatch):
+		return &t.Mismatched
+	case m.has(matchHardlink):
+		return &t.Links
+	case m.has(matchClone):
+		return &t.Cloned
+	case m.has(matchPartial):
+		return &t.Partial
+	}
+	return &t.Dupes
+}
+
 func (t *totals) PrettyFormat(v verb) string {
 	lines := []string{
 		fmt.Sprintf("%s elapsed", t.End()),
@@ -396,12 +843,21 @@ func (t *totals) PrettyFormat(v verb) string {
 		suffix string
 	}{
 		{t.Files, "scanned"},
+		{t.Traversal, "skipped by traversal rules"},
 		{t.Unique, "unique"},
 		{t.Links, "as hardlinks"},
 		{t.Cloned, "as clones"},
+		{t.Partial, "as partial clones"},
 		{t.Dupes, "duplicated"},
+		{t.Mismatched, "with mismatched owner or permissions"},
+		{t.CrossDevice, "on different devices"},
+		{t.RedundantLinks, "as redundant symlinks"},
+		{t.BrokenLinks, "as broken symlinks"},
 		{},
 		{t.Processed, fmt.Sprintf("%s successfully", v.PastTense())},
+		{t.LinkGroups, "kept as new link groups"},
+		{t.Changed, "changed since planned"},
+		{t.PrunedLinks, "pruned as redundant or broken symlinks"},
 		{t.Skipped, "skipped"},
 		{t.Errors, "had errors"},
 	} {
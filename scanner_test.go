@@ -1,14 +1,19 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/josephvusich/fdf/report"
 	"github.com/josephvusich/go-matchers"
 	"github.com/josephvusich/go-matchers/glob"
 	"github.com/mattn/go-zglob"
@@ -204,6 +209,205 @@ func TestScanner_LinkUnlink(t *testing.T) {
 	})
 }
 
+func TestScanner_Jobs(t *testing.T) {
+	assert := require.New(t)
+	setupTest(assert, func(l *testLayout, validate func(*testLayout)) {
+		scanner := newScanner()
+		scanner.options.makeLinks = true
+		scanner.options.Recursive = true
+		scanner.options.MatchMode = matchContent
+		scanner.options.Jobs = 4
+
+		assert.NoError(scanner.Scan())
+		fmt.Println(scanner.totals.PrettyFormat(scanner.options.Verb()))
+		assert.Equal(uint64(22), scanner.totals.Files.count)
+		assert.Equal(uint64(73), scanner.totals.Files.size)
+		assert.Equal(uint64(7), scanner.totals.Unique.count)
+		assert.Equal(uint64(33), scanner.totals.Unique.size)
+		assert.Equal(uint64(15), scanner.totals.Links.count)
+		assert.Equal(uint64(40), scanner.totals.Links.size)
+		assert.Equal(uint64(0), scanner.totals.Dupes.count)
+		assert.Equal(uint64(0), scanner.totals.Dupes.size)
+		assert.Equal(uint64(15), scanner.totals.Processed.count)
+		assert.Equal(uint64(40), scanner.totals.Processed.size)
+		assert.Equal(uint64(0), scanner.totals.Errors.count)
+		assert.Equal(uint64(0), scanner.totals.Errors.size)
+		validate(l)
+	})
+}
+
+func TestScanner_JobsHashBuckets(t *testing.T) {
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./d",
+		},
+		content: map[string]string{
+			"a": "foo1",
+			"b": "foo2",
+			"c": "foo3",
+			"d": "foo4",
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		// Each checksum waits for the whole bucket to begin hashing,
+		// which only happens if separate files are hashed concurrently
+		var started, timedOut int32
+		checksumStarted = func(r *fileRecord) {
+			atomic.AddInt32(&started, 1)
+			for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+				if atomic.LoadInt32(&started) >= int32(len(l.content)) {
+					return
+				}
+			}
+			atomic.AddInt32(&timedOut, 1)
+		}
+		defer func() {
+			checksumStarted = func(r *fileRecord) {}
+		}()
+
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `--jobs`, `4`}))
+		assert.NoError(scanner.Scan())
+		assert.Equal(int32(0), atomic.LoadInt32(&timedOut))
+		assert.Equal(int32(len(l.content)), atomic.LoadInt32(&started))
+		assert.Equal(uint64(4), scanner.totals.Unique.count)
+		validate(l)
+	})
+}
+
+func TestScanner_Auto(t *testing.T) {
+	assert := require.New(t)
+	setupTest(assert, func(l *testLayout, validate func(*testLayout)) {
+		// Devices are never probed under --dry-run
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `-z`, `0`, `--auto`, `--dry-run`}))
+		assert.NoError(scanner.Scan())
+		assert.Empty(scanner.table.devices.m)
+		assert.Equal(uint64(0), scanner.totals.Processed.count)
+		validate(l)
+
+		scanner = newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `-z`, `0`, `--auto`}))
+		assert.Equal(VerbAuto, scanner.options.Verb())
+
+		assert.NoError(scanner.Scan())
+		fmt.Println(scanner.totals.PrettyFormat(scanner.options.Verb()))
+		assert.Equal(uint64(22), scanner.totals.Files.count)
+		assert.Equal(uint64(7), scanner.totals.Unique.count)
+		assert.Equal(uint64(15), scanner.totals.Links.count+scanner.totals.Cloned.count)
+		assert.Equal(uint64(15), scanner.totals.Processed.count)
+		assert.Equal(uint64(0), scanner.totals.CrossDevice.count)
+		assert.Equal(uint64(0), scanner.totals.Errors.count)
+		validate(l)
+	})
+}
+
+func TestScanner_TwoPhase(t *testing.T) {
+	assert := require.New(t)
+	setupTest(assert, func(l *testLayout, validate func(*testLayout)) {
+		scanner := newScanner()
+		scanner.options.makeLinks = true
+		scanner.options.Recursive = true
+		scanner.options.MatchMode = matchContent
+		scanner.options.TwoPhase = true
+
+		assert.NoError(scanner.Scan())
+		fmt.Println(scanner.totals.PrettyFormat(scanner.options.Verb()))
+		assert.Equal(uint64(22), scanner.totals.Files.count)
+		assert.Equal(uint64(73), scanner.totals.Files.size)
+		assert.Equal(uint64(7), scanner.totals.Unique.count)
+		assert.Equal(uint64(33), scanner.totals.Unique.size)
+		assert.Equal(uint64(15), scanner.totals.Links.count)
+		assert.Equal(uint64(40), scanner.totals.Links.size)
+		assert.Equal(uint64(0), scanner.totals.Dupes.count)
+		assert.Equal(uint64(0), scanner.totals.Dupes.size)
+		assert.Equal(uint64(15), scanner.totals.Processed.count)
+		assert.Equal(uint64(40), scanner.totals.Processed.size)
+		assert.Equal(uint64(0), scanner.totals.Errors.count)
+		assert.Equal(uint64(0), scanner.totals.Errors.size)
+		validate(l)
+
+		// diffSize files have unique sizes, and should never have been opened
+		for r := range scanner.table.db.query(&query{Size: int64(len(l.diffSize[1]))}) {
+			assert.Fail("singleton entered the index", r.FilePath)
+		}
+	})
+}
+
+func TestScanner_TrustHash(t *testing.T) {
+	assert := require.New(t)
+	setupTest(assert, func(l *testLayout, validate func(*testLayout)) {
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-rl`, `-z`, `0`, `--hash`, `sha256`, `--trust-hash`}))
+		assert.Equal(HashSHA256, scanner.options.HashAlgorithm)
+		assert.True(scanner.options.TrustHash)
+
+		assert.NoError(scanner.Scan())
+		fmt.Println(scanner.totals.PrettyFormat(scanner.options.Verb()))
+		assert.Equal(uint64(22), scanner.totals.Files.count)
+		assert.Equal(uint64(73), scanner.totals.Files.size)
+		assert.Equal(uint64(7), scanner.totals.Unique.count)
+		assert.Equal(uint64(33), scanner.totals.Unique.size)
+		assert.Equal(uint64(15), scanner.totals.Links.count)
+		assert.Equal(uint64(40), scanner.totals.Links.size)
+		assert.Equal(uint64(15), scanner.totals.Processed.count)
+		assert.Equal(uint64(40), scanner.totals.Processed.size)
+		assert.Equal(uint64(0), scanner.totals.Errors.count)
+		validate(l)
+	})
+}
+
+func TestScanner_LinkLimit(t *testing.T) {
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./d",
+		},
+		content: map[string]string{
+			"a": "foobar",
+			"b": "foobar",
+			"c": "foobar",
+			"d": "foobar",
+			"e": "foobar",
+		},
+	}
+
+	// Simulate a filesystem that allows only two links per file
+	links := map[string]int{}
+	linkFile = func(src, dst string) error {
+		if links[src]++; links[src] > 1 {
+			return &os.LinkError{Op: "link", Old: src, New: dst, Err: syscall.EMLINK}
+		}
+		return os.Link(src, dst)
+	}
+	defer func() { linkFile = os.Link }()
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-rl`, `--timestamps`, `ignore`}))
+
+		assert.NoError(scanner.Scan())
+		fmt.Println(scanner.totals.PrettyFormat(scanner.options.Verb()))
+		assert.Equal(uint64(5), scanner.totals.Files.count)
+		assert.Equal(uint64(2), scanner.totals.Processed.count)
+		assert.Equal(uint64(2), scanner.totals.LinkGroups.count)
+		assert.Equal(uint64(0), scanner.totals.Errors.count)
+		validate(l)
+
+		stat := func(name string) os.FileInfo {
+			st, err := os.Stat(name)
+			assert.NoError(err)
+			return st
+		}
+		assert.True(os.SameFile(stat("d/a"), stat("d/b")))
+		assert.True(os.SameFile(stat("d/c"), stat("d/d")))
+		assert.False(os.SameFile(stat("d/a"), stat("d/c")))
+		assert.False(os.SameFile(stat("d/c"), stat("d/e")))
+	})
+}
+
 func TestScanner_Timestamps(t *testing.T) {
 	assert := require.New(t)
 
@@ -289,6 +493,59 @@ func TestScanner_Delete(t *testing.T) {
 	})
 }
 
+func TestScanner_MoveTo(t *testing.T) {
+	assert := require.New(t)
+	setupTest(assert, func(l *testLayout, validate func(*testLayout)) {
+		// Collides with b/foo, and must not be scanned itself
+		assert.NoError(os.MkdirAll("q/b", 0777))
+		assert.NoError(ioutil.WriteFile("q/b/foo", []byte("foo\n"), 0666))
+
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `-z`, `0`, `--move-to`, `q`}))
+		assert.Equal(VerbMove, scanner.options.Verb())
+
+		assert.NoError(scanner.Scan())
+		fmt.Println(scanner.totals.PrettyFormat(scanner.options.Verb()))
+		assert.Equal(uint64(22), scanner.totals.Files.count)
+		assert.Equal(uint64(7), scanner.totals.Unique.count)
+		assert.Equal(uint64(15), scanner.totals.Processed.count)
+		assert.Equal(uint64(40), scanner.totals.Processed.size)
+		assert.Equal(uint64(0), scanner.totals.Errors.count)
+
+		b, err := ioutil.ReadFile("q/b/foo (1)")
+		assert.NoError(err)
+		assert.Equal("foo\n", string(b))
+
+		f, err := os.Open(filepath.Join("q", quarantineManifest))
+		assert.NoError(err)
+		defer f.Close()
+
+		// Each move is recorded as pending, then as moved
+		pending, moves := 0, 0
+		dec := json.NewDecoder(f)
+		for dec.More() {
+			var m report.Move
+			assert.NoError(dec.Decode(&m))
+			if m.Status == report.MovePending {
+				pending++
+				continue
+			}
+			assert.Equal(report.MoveDone, m.Status)
+			moves++
+
+			_, err = os.Stat(m.Original)
+			assert.True(os.IsNotExist(err), m.Original)
+			b, err = ioutil.ReadFile(m.Moved)
+			assert.NoError(err)
+			assert.Equal(m.Size, int64(len(b)))
+			assert.True(strings.HasPrefix(m.Moved, scanner.quarantine.dir), m.Moved)
+			assert.NotEmpty(m.Kept)
+		}
+		assert.Equal(15, pending)
+		assert.Equal(15, moves)
+	})
+}
+
 func TestScanner_DeleteProtect(t *testing.T) {
 	assert := require.New(t)
 	setupTest(assert, func(l *testLayout, validate func(*testLayout)) {
@@ -786,6 +1043,77 @@ func TestScanner_PathSuffix(t *testing.T) {
 	})
 }
 
+func TestScanner_Hidden(t *testing.T) {
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./a",
+			"./.b",
+		},
+		content: map[string]string{
+			"x":  "foobar",
+			".y": "foobar",
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		for _, x := range []struct {
+			args  []string
+			files uint64
+		}{
+			{nil, 1},
+			{[]string{`--hidden-files`}, 2},
+			{[]string{`--hidden-dirs`}, 2},
+			{[]string{`--hidden`}, 4},
+			{[]string{`--hidden`, `--silent-skip`, `.y`}, 2},
+			{[]string{`--hidden`, `--silent-skip`, `.b`}, 2},
+		} {
+			scanner := newScanner()
+			assert.Empty(scanner.options.ParseArgs(append([]string{`fdf`, `-r`}, x.args...)))
+			assert.NoError(scanner.Scan())
+			assert.Equal(x.files, scanner.totals.Files.count, "%v", x.args)
+			assert.Equal(uint64(0), scanner.totals.Errors.count)
+		}
+
+		assert.Error(nameSet{}.Set("a/b"))
+	})
+}
+
+func TestScanner_Depth(t *testing.T) {
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./a",
+			"./a/b",
+			"./a/b/c",
+		},
+		content: map[string]string{
+			"x": "foobar",
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		for _, x := range []struct {
+			args      []string
+			files     uint64
+			traversal uint64
+		}{
+			{nil, 3, 0},
+			{[]string{`--one-file-system`}, 3, 0},
+			{[]string{`--max-depth`, `2`}, 1, 1},
+			{[]string{`--max-depth`, `3`}, 2, 1},
+			{[]string{`--min-depth`, `3`}, 2, 1},
+			{[]string{`--min-depth`, `3`, `--max-depth`, `3`}, 1, 2},
+		} {
+			scanner := newScanner()
+			assert.Empty(scanner.options.ParseArgs(append([]string{`fdf`, `-r`}, x.args...)))
+			assert.NoError(scanner.Scan())
+			assert.Equal(x.files, scanner.totals.Files.count, "%v", x.args)
+			assert.Equal(x.traversal, scanner.totals.Traversal.count, "%v", x.args)
+		}
+	})
+}
+
 type testLayout struct {
 	dirs []string
 
@@ -836,6 +1164,9 @@ func setupTestLayout(assert *require.Assertions, l *testLayout, f func(l *testLa
 	dir, err := ioutil.TempDir("", "fdftest")
 	assert.NoError(err)
 	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	assert.NoError(err)
+	defer os.Chdir(wd)
 	assert.NoError(os.Chdir(dir))
 
 	for i, d := range l.dirs {
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/josephvusich/fdf/report"
+)
+
+// Defined at the top of every --script, and used to guard each command
+const scriptPrelude = `set -u
+
+# Succeeds if both files exist with the expected size
+same_size() {
+	[ -f "$1" ] && [ ! -L "$1" ] && [ -f "$2" ] &&
+		[ "$(wc -c < "$1")" -eq "$3" ] && [ "$(wc -c < "$2")" -eq "$3" ]
+}
+
+skip() {
+	printf 'skipped: %s\n' "$1" >&2
+}
+
+# Copies the owner, mode, and timestamps of $1 to $2, as --metadata does.
+# Ownership is only copied where permitted.
+metadata() {
+	chown --reference="$1" -- "$2" 2>/dev/null
+	chmod --reference="$1" -- "$2" && touch -r "$1" -- "$2"
+}
+
+# Replaces $3 with a copy of $2 made by cp with options $1, written to a
+# temporary file beside $3, then given the metadata of $4 unless it is empty
+replace() {
+	tmp=$(mktemp "$(dirname -- "$3")/.fdf-XXXXXX") || return 1
+	if cp $1 -- "$2" "$tmp" && { [ -z "$4" ] || metadata "$4" "$tmp"; } && mv -f -- "$tmp" "$3"; then
+		return 0
+	fi
+	rm -f -- "$tmp"
+	return 1
+}
+
+# Appends the JSON fields $2 to the --move-to manifest $1 with status $3
+record() {
+	printf '{"time":"%s",%s,"status":"%s"}\n' "$(date -u +%Y-%m-%dT%H:%M:%SZ)" "$2" "$3" >> "$1"
+}
+
+# Moves $2 to $3, which must not exist, recording it in the manifest $1 with fields $4
+move() {
+	[ ! -e "$3" ] && mkdir -p -- "$(dirname -- "$3")" && record "$1" "$4" pending || return 1
+	if mv -- "$2" "$3"; then
+		record "$1" "$4" moved
+	else
+		record "$1" "$4" failed
+		return 1
+	fi
+}
+`
+
+// script accumulates the shell commands written by --script
+type script struct {
+	body    bytes.Buffer
+	actions total
+}
+
+// add appends the shell equivalent of replacing current with match by verb
+func (s *script) add(o *options, q *quarantine, v verb, match, current *fileRecord) error {
+	kept, replaced := shellQuote(match.FilePath), shellQuote(current.FilePath)
+
+	// Metadata is taken from the same file as by copyMetadata, if any
+	ref := replaced
+	switch o.MetadataPolicy {
+	case MetadataIgnore:
+		ref = "''"
+	case MetadataTakeKept:
+		ref = kept
+	}
+
+	var cmd string
+	switch v {
+	case VerbMakeLinks:
+		cmd = fmt.Sprintf("ln -f -- %s %s", kept, replaced)
+	case VerbClone:
+		cmd = fmt.Sprintf("replace --reflink=always %s %s %s", kept, replaced, ref)
+	case VerbAuto:
+		// Clone where supported, otherwise hardlink unless --auto would refuse to
+		cmd = fmt.Sprintf("replace --reflink=always %s %s %s", kept, replaced, ref)
+		if o.LinkMismatched || sameOwnerAndMode(match, current) {
+			cmd = fmt.Sprintf("{ %s 2>/dev/null || ln -f -- %s %s; }", cmd, kept, replaced)
+		}
+	case VerbSplitLinks:
+		// Copy to a temporary name, as writing to a hardlink would also modify the kept file
+		cmd = fmt.Sprintf("replace '' %s %s %s", kept, replaced, ref)
+	case VerbDelete:
+		cmd = fmt.Sprintf("rm -f -- %s", replaced)
+	case VerbSymlink:
+		target, err := symlinkTarget(match.FilePath, current.FilePath, o.Symlink)
+		if err != nil {
+			return err
+		}
+		cmd = fmt.Sprintf("ln -sf -- %s %s", shellQuote(target), replaced)
+	case VerbMove:
+		dst := q.target(current)
+		b, err := json.Marshal(&report.Move{
+			Original: current.FilePath,
+			Moved:    dst,
+			Kept:     match.FilePath,
+			Size:     current.Size(),
+		})
+		if err != nil {
+			return err
+		}
+		// Only the fields between time and status, which are added by record
+		fields := strings.TrimPrefix(string(b), `{"time":"0001-01-01T00:00:00Z",`)
+		fields = strings.TrimSuffix(fields, `,"status":""}`)
+		cmd = fmt.Sprintf("move %s %s %s %s",
+			shellQuote(filepath.Join(q.dir, quarantineManifest)), replaced, shellQuote(dst), shellQuote(fields))
+	default:
+		panic(fmt.Sprintf("no shell equivalent for verb %d", v))
+	}
+
+	fmt.Fprintf(&s.body, "if same_size %s %s %d; then %s || skip %s; else skip %s; fi\n",
+		kept, replaced, current.Size(), cmd, replaced, replaced)
+	s.actions.Add(current)
+	return nil
+}
+
+// Write saves the script to path, with a header describing the expected results
+func (s *script) Write(path string, t *totals, v verb) error {
+	fmt.Printf("Writing %s...\n", path)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var header bytes.Buffer
+	fmt.Fprintf(&header, "#!/bin/sh\n# Generated by fdf on %s\n#\n# Expected results:\n", time.Now().Format(time.RFC1123))
+
+	// Only the scan results, as the remaining totals describe the dry run itself
+	lines := strings.Split(t.PrettyFormat(v), "\n")
+	for _, line := range lines[1:] {
+		if line == "" {
+			break
+		}
+		fmt.Fprintf(&header, "#   %s\n", line)
+	}
+	count, size := s.actions.Get()
+	fmt.Fprintf(&header, "#   %d files (%s) to be %s by this script\n\n", count, humanize.IBytes(size), v.PastTense())
+
+	for _, b := range [][]byte{header.Bytes(), []byte(scriptPrelude), []byte("\n"), s.body.Bytes()} {
+		if _, err = f.Write(b); err != nil {
+			return err
+		}
+	}
+	return f.Close()
+}
+
+// shellQuote returns s as a single-quoted POSIX shell word. Single quotes
+// preserve every byte except the single quote itself, which is escaped.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
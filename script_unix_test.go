@@ -0,0 +1,199 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/josephvusich/fdf/report"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShellQuote(t *testing.T) {
+	assert := require.New(t)
+
+	assert.Equal(`'foo bar'`, shellQuote("foo bar"))
+	assert.Equal(`'it'\''s'`, shellQuote("it's"))
+	assert.Equal(`'$(rm -rf /) `+"`x`"+`'`, shellQuote("$(rm -rf /) `x`"))
+	assert.Equal(`''`, shellQuote(""))
+}
+
+func TestScanner_Script(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./d",
+		},
+		content: map[string]string{
+			"a":      "foobar",
+			"c":      "foobar",
+			"it's b": "foobar",
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		scriptDir, err := ioutil.TempDir("", "fdfscript")
+		assert.NoError(err)
+		defer os.RemoveAll(scriptDir)
+		scriptPath := filepath.Join(scriptDir, "fdf.sh")
+
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `--timestamps`, `ignore`, `--link`, `--script`, scriptPath}))
+		assert.True(scanner.options.DryRun)
+		assert.NoError(scanner.Scan())
+		assert.Equal(uint64(0), scanner.totals.Processed.count)
+		assert.Equal(uint64(2), scanner.totals.Skipped.count)
+
+		// Nothing changed yet
+		validate(l)
+
+		b, err := ioutil.ReadFile(scriptPath)
+		assert.NoError(err)
+		assert.True(strings.HasPrefix(string(b), "#!/bin/sh\n"))
+		assert.Contains(string(b), "2 files (12 B) to be hardlinked by this script")
+		assert.Contains(string(b), `/d/it'\''s b'`)
+
+		// A file that changed size is skipped by the script
+		assert.NoError(ioutil.WriteFile("d/c", []byte("foo"), 0666))
+
+		out, err := exec.Command(sh, scriptPath).CombinedOutput()
+		assert.NoError(err, string(out))
+		assert.Contains(string(out), "skipped: ")
+		assert.Contains(string(out), "/d/c\n")
+
+		a, err := os.Stat("d/a")
+		assert.NoError(err)
+		st, err := os.Stat("d/it's b")
+		assert.NoError(err)
+		assert.True(os.SameFile(a, st))
+
+		st, err = os.Stat("d/c")
+		assert.NoError(err)
+		assert.False(os.SameFile(a, st))
+	})
+}
+
+func TestScanner_ScriptMove(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./d",
+		},
+		content: map[string]string{
+			"a": "foobar",
+			"b": "foobar",
+			"c": "foobar",
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		scriptDir, err := ioutil.TempDir("", "fdfscript")
+		assert.NoError(err)
+		defer os.RemoveAll(scriptDir)
+		scriptPath := filepath.Join(scriptDir, "fdf.sh")
+
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `--timestamps`, `ignore`, `--move-to`, `q`, `--script`, scriptPath}))
+		assert.NoError(scanner.Scan())
+		validate(l)
+
+		// Collides with d/c, which the script must skip rather than overwrite
+		assert.NoError(os.MkdirAll("q/d", 0777))
+		assert.NoError(ioutil.WriteFile("q/d/c", []byte("fizz"), 0666))
+
+		out, err := exec.Command(sh, scriptPath).CombinedOutput()
+		assert.NoError(err, string(out))
+		assert.Contains(string(out), "/d/c\n")
+		_, err = os.Stat("d/c")
+		assert.NoError(err)
+
+		f, err := os.Open(filepath.Join("q", quarantineManifest))
+		assert.NoError(err)
+		defer f.Close()
+
+		var statuses []string
+		dec := json.NewDecoder(f)
+		for dec.More() {
+			var m report.Move
+			assert.NoError(dec.Decode(&m))
+			statuses = append(statuses, m.Status)
+			assert.False(m.Time.IsZero())
+			assert.Equal(int64(6), m.Size)
+			assert.Equal("b", filepath.Base(m.Original))
+			_, err = os.Stat(m.Moved)
+			assert.NoError(err)
+		}
+		assert.Equal([]string{report.MovePending, report.MoveDone}, statuses)
+	})
+}
+
+func TestScanner_ScriptCopy(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./d",
+		},
+		content: map[string]string{
+			"a": "foobar",
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		scriptDir, err := ioutil.TempDir("", "fdfscript")
+		assert.NoError(err)
+		defer os.RemoveAll(scriptDir)
+		scriptPath := filepath.Join(scriptDir, "fdf.sh")
+
+		assert.NoError(os.Chmod("d/a", 0640))
+		assert.NoError(os.Link("d/a", "d/b"))
+		before, err := os.Stat("d/b")
+		assert.NoError(err)
+
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `--copy`, `--script`, scriptPath}))
+		assert.NoError(scanner.Scan())
+
+		out, err := exec.Command(sh, scriptPath).CombinedOutput()
+		assert.NoError(err, string(out))
+		assert.Empty(string(out))
+
+		// Split into an independent copy that keeps the metadata of the duplicate
+		a, err := os.Stat("d/a")
+		assert.NoError(err)
+		b, err := os.Stat("d/b")
+		assert.NoError(err)
+		assert.False(os.SameFile(a, b))
+		assert.Equal(before.Mode(), b.Mode())
+		assert.True(before.ModTime().Equal(b.ModTime()))
+
+		// No temporary files are left behind
+		names, err := filepath.Glob("d/*")
+		assert.NoError(err)
+		assert.Len(names, 2)
+
+		assert.NoError(os.Remove("d/b"))
+		validate(l)
+	})
+}
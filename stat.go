@@ -0,0 +1,14 @@
+package main
+
+import "time"
+
+// statInfo holds the platform-specific fields of a stat() call
+type statInfo struct {
+	Dev   uint64
+	Ino   uint64
+	Nlink uint64
+	Uid   uint32
+	Gid   uint32
+	Atime time.Time
+	Ctime time.Time
+}
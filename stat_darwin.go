@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+const statSupported = true
+
+// getStatInfo returns false if fi was not produced by os.Stat or os.Lstat
+func getStatInfo(fi os.FileInfo) (s statInfo, ok bool) {
+	if fi == nil {
+		return s, false
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return s, false
+	}
+	return statInfo{
+		Dev:   uint64(st.Dev),
+		Ino:   uint64(st.Ino),
+		Nlink: uint64(st.Nlink),
+		Uid:   st.Uid,
+		Gid:   st.Gid,
+		Atime: time.Unix(st.Atimespec.Unix()),
+		Ctime: time.Unix(st.Ctimespec.Unix()),
+	}, true
+}
@@ -0,0 +1,10 @@
+package main
+
+import "os"
+
+const statSupported = false
+
+// getStatInfo is not supported on Windows
+func getStatInfo(fi os.FileInfo) (s statInfo, ok bool) {
+	return s, false
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// symlinkTarget returns the target of a symlink at replaced that refers to kept,
+// in the --symlink style. Relative targets are computed between resolved parent
+// directories, so that they remain valid when either path traverses a symlink.
+func symlinkTarget(kept, replaced, style string) (string, error) {
+	if style == SymlinkAbsolute {
+		return filepath.Abs(kept)
+	}
+
+	keptDir, err := filepath.EvalSymlinks(filepath.Dir(kept))
+	if err != nil {
+		return "", err
+	}
+	linkDir, err := filepath.EvalSymlinks(filepath.Dir(replaced))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Rel(linkDir, filepath.Join(keptDir, filepath.Base(kept)))
+}
+
+// fileKey identifies a directory or file for --follow-symlinks,
+// by path where the device and inode are unavailable
+type fileKey struct {
+	dev, ino uint64
+	path     string
+}
+
+func newFileKey(path string, info os.FileInfo) fileKey {
+	if s, ok := getStatInfo(info); ok {
+		return fileKey{dev: s.Dev, ino: s.Ino}
+	}
+	return fileKey{path: path}
+}
+
+// walk visits every file below root. If linkPath is set, root is the resolved
+// target of a symlinked directory, and files are walked by their path through linkPath.
+func (f *scanner) walk(root, linkPath string) error {
+	suffixes := map[string]string{}
+
+	return filepath.Walk(root, func(path string, info os.FileInfo, inErr error) error {
+		walked := path
+		if linkPath != "" {
+			path = filepath.Join(linkPath, strings.TrimPrefix(walked, root))
+		}
+
+		if f.options.FollowSymlinks && inErr == nil && f.revisited(walked, info) {
+			if f.options.Verbose {
+				fmt.Printf("%s: skipping, already visited\n", path)
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		pathSuffix := ""
+		if info != nil && !info.IsDir() {
+			dir := filepath.Dir(path)
+			suffix, ok := suffixes[dir]
+			if !ok {
+				var err error
+				if suffix, err = filepath.Rel(f.table.scanDir, dir); err != nil {
+					suffix = dir
+				}
+				suffixes[dir] = suffix
+			}
+			pathSuffix = suffix
+		}
+		return f.walkFunc(path, pathSuffix, info, inErr)
+	})
+}
+
+// revisited returns true if path is a directory that was already walked, or a file
+// that was already walked and is now reached through a symlink. Hardlinks found by
+// the main walk are still compared, as they are distinct paths within the scan.
+func (f *scanner) revisited(path string, info os.FileInfo) bool {
+	if info == nil || info.Mode()&os.ModeSymlink != 0 {
+		return false
+	}
+
+	k := newFileKey(path, info)
+	if _, ok := f.visited[k]; ok {
+		return info.IsDir() || f.table.viaSymlink
+	}
+	if f.visited == nil {
+		f.visited = make(map[fileKey]struct{})
+	}
+	f.visited[k] = struct{}{}
+	return false
+}
+
+// followSymlinks walks the targets of the symlinks deferred by walkFunc,
+// including any further symlinks found within symlinked directories
+func (f *scanner) followSymlinks() error {
+	f.table.viaSymlink = true
+	defer func() {
+		f.table.viaSymlink = false
+	}()
+
+	for len(f.links) != 0 {
+		l := f.links[0]
+		f.links = f.links[1:]
+		f.table.scanDir, f.table.relDir = l.scanDir, l.relDir
+
+		target, err := filepath.EvalSymlinks(l.path)
+		if err != nil {
+			if f.options.Verbose {
+				fmt.Printf("%s: skipping broken symlink\n", l.path)
+			}
+			continue
+		}
+		st, err := os.Stat(target)
+		if err != nil {
+			fmt.Printf("%s: %s\n", l.path, err)
+			continue
+		}
+
+		if st.IsDir() {
+			if err = f.walk(target, l.path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if f.revisited(target, st) {
+			if f.options.Verbose {
+				fmt.Printf("%s: skipping, already visited\n", l.path)
+			}
+			continue
+		}
+		if err = f.walkFunc(l.path, l.pathSuffix, st, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/josephvusich/fdf/report"
+	"github.com/mattn/go-zglob"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptions_Symlink(t *testing.T) {
+	assert := require.New(t)
+
+	o := &options{}
+	assert.Empty(o.ParseArgs([]string{`fdf`, `--symlink`}))
+	assert.Equal(VerbSymlink, o.Verb())
+	assert.Equal(SymlinkRelative, o.Symlink)
+
+	o = &options{}
+	assert.Empty(o.ParseArgs([]string{`fdf`, `--symlink=absolute`}))
+	assert.Equal(VerbSymlink, o.Verb())
+	assert.Equal(SymlinkAbsolute, o.Symlink)
+
+	assert.Error(symlinkFlag{&o.Symlink}.Set("sideways"))
+}
+
+func TestScanner_Symlink(t *testing.T) {
+	assert := require.New(t)
+	setupTest(assert, func(l *testLayout, validate func(*testLayout)) {
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `-z`, `0`, `--symlink`}))
+
+		assert.NoError(scanner.Scan())
+		fmt.Println(scanner.totals.PrettyFormat(scanner.options.Verb()))
+		assert.Equal(uint64(22), scanner.totals.Files.count)
+		assert.Equal(uint64(15), scanner.totals.Processed.count)
+		assert.Equal(uint64(0), scanner.totals.Errors.count)
+		validate(l)
+
+		glob, err := zglob.Glob("./**/*")
+		assert.NoError(err)
+		var links int
+		for _, x := range glob {
+			st, err := os.Lstat(x)
+			assert.NoError(err)
+			if st.Mode()&os.ModeSymlink == 0 {
+				continue
+			}
+			links++
+
+			target, err := os.Readlink(x)
+			assert.NoError(err)
+			assert.False(filepath.IsAbs(target), x)
+
+			// Links always refer to a regular file
+			st, err = os.Lstat(filepath.Join(filepath.Dir(x), target))
+			assert.NoError(err)
+			assert.True(st.Mode().IsRegular(), x)
+		}
+		assert.Equal(15, links)
+
+		// Links created by the first run are never matched again
+		scanner = newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `-z`, `0`, `--symlink`}))
+		assert.NoError(scanner.Scan())
+		assert.Equal(uint64(7), scanner.totals.Files.count)
+		assert.Equal(uint64(0), scanner.totals.Processed.count)
+		validate(l)
+	})
+}
+
+func TestScanner_SymlinkAbsolute(t *testing.T) {
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./a",
+			"./b",
+		},
+		content: map[string]string{
+			"x": "foobar",
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		journalDir, err := ioutil.TempDir("", "fdfjournal")
+		assert.NoError(err)
+		defer os.RemoveAll(journalDir)
+		journalPath := filepath.Join(journalDir, "journal.jsonl")
+
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `--symlink=absolute`, `--protect`, `b/x`, `--journal`, journalPath}))
+		assert.NoError(scanner.Scan())
+		assert.Equal(uint64(1), scanner.totals.Processed.count)
+		validate(l)
+
+		// The protected file is kept
+		target, err := os.Readlink("a/x")
+		assert.NoError(err)
+		abs, err := filepath.Abs("b/x")
+		assert.NoError(err)
+		assert.Equal(abs, target)
+
+		assert.Equal(0, undo([]string{journalPath}))
+		st, err := os.Lstat("a/x")
+		assert.NoError(err)
+		assert.True(st.Mode().IsRegular())
+		validate(l)
+	})
+}
+
+func TestScanner_FollowSymlinks(t *testing.T) {
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./a",
+		},
+		content: map[string]string{
+			"x": "foobar",
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		ext, err := ioutil.TempDir("", "fdfext")
+		assert.NoError(err)
+		defer os.RemoveAll(ext)
+		assert.NoError(ioutil.WriteFile(filepath.Join(ext, "y"), []byte("foobar"), 0666))
+		assert.NoError(ioutil.WriteFile(filepath.Join(ext, "z"), []byte("fizzbuzz"), 0666))
+
+		assert.NoError(os.Symlink(ext, "a/ext"))
+		assert.NoError(os.Symlink(ext, "a/ext2"))
+		assert.NoError(os.Symlink("..", "a/loop"))
+		assert.NoError(os.Symlink("x", "a/xlink"))
+		assert.NoError(os.Symlink("missing", "a/broken"))
+
+		// Symlinks are skipped by default
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `--timestamps`, `ignore`}))
+		assert.NoError(scanner.Scan())
+		assert.Equal(uint64(1), scanner.totals.Files.count)
+
+		scanner = newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `--timestamps`, `ignore`, `--link`, `--follow-symlinks`}))
+		assert.NoError(scanner.Scan())
+		fmt.Println(scanner.totals.PrettyFormat(scanner.options.Verb()))
+
+		// Each target is walked once, and the loop is not followed
+		assert.Equal(uint64(3), scanner.totals.Files.count)
+		assert.Equal(uint64(1), scanner.totals.Processed.count)
+		assert.Equal(uint64(0), scanner.totals.Errors.count)
+
+		// The file reached through a symlink is kept, never replaced
+		x, err := os.Stat("a/x")
+		assert.NoError(err)
+		y, err := os.Lstat(filepath.Join(ext, "y"))
+		assert.NoError(err)
+		assert.True(y.Mode().IsRegular())
+		assert.True(os.SameFile(x, y))
+
+		for _, name := range []string{"a/ext", "a/ext2", "a/loop", "a/xlink", "a/broken"} {
+			st, err := os.Lstat(name)
+			assert.NoError(err)
+			assert.NotZero(st.Mode()&os.ModeSymlink, name)
+		}
+	})
+}
+
+func TestScanner_SymlinkAudit(t *testing.T) {
+	assert := require.New(t)
+	l := &testLayout{
+		dirs: []string{
+			"./a",
+		},
+		content: map[string]string{
+			"x": "foobar",
+			"y": "fizzbuzz",
+		},
+	}
+
+	setupTestLayout(assert, l, func(l *testLayout, validate func(*testLayout)) {
+		reportDir, err := ioutil.TempDir("", "fdfreport")
+		assert.NoError(err)
+		defer os.RemoveAll(reportDir)
+		reportPath := filepath.Join(reportDir, "report.json")
+
+		assert.NoError(os.Symlink("x", "a/l1"))
+		assert.NoError(os.Symlink("x", "a/l2"))
+		assert.NoError(os.Symlink("./x", "a/l3"))
+		assert.NoError(os.Symlink("y", "a/l4"))
+		assert.NoError(os.Symlink("y", "a/l5"))
+		assert.NoError(os.Symlink("missing", "a/m1"))
+		assert.NoError(os.Symlink("missing", "a/m2"))
+
+		args := []string{`fdf`, `-r`, `--protect`, `a/l2`, `--exclude`, `a/l5`}
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs(append(args, `--symlink-audit`)))
+		assert.NoError(scanner.Scan())
+		assert.Equal(uint64(2), scanner.totals.RedundantLinks.count)
+		assert.Equal(uint64(2), scanner.totals.BrokenLinks.count)
+		assert.Equal(uint64(0), scanner.totals.PrunedLinks.count)
+
+		assert.NoError(writeReport(reportPath, nil, nil, scanner.table.db, scanner.options.Filters(), scanner.audit))
+		b, err := ioutil.ReadFile(reportPath)
+		assert.NoError(err)
+		r := &report.Report{}
+		assert.NoError(json.Unmarshal(b, r))
+		assert.NotNil(r.Symlinks)
+		abs := func(name string) string {
+			p, err := filepath.Abs(name)
+			assert.NoError(err)
+			return p
+		}
+		x, err := filepath.EvalSymlinks(abs("a/x"))
+		assert.NoError(err)
+		assert.Equal([][]string{{x, abs("a/l1"), abs("a/l2"), abs("a/l3")}}, r.Symlinks.SameTarget)
+		assert.Equal([][]string{{"x", abs("a/l1"), abs("a/l2")}, {"missing", abs("a/m1"), abs("a/m2")}}, r.Symlinks.SameText)
+		assert.Equal([]string{abs("a/m1"), abs("a/m2")}, r.Symlinks.Broken)
+
+		journalPath := filepath.Join(reportDir, "journal.jsonl")
+		scanner = newScanner()
+		assert.Empty(scanner.options.ParseArgs(append(args, `--prune-symlinks`, `--journal`, journalPath)))
+		assert.NoError(scanner.Scan())
+		assert.Equal(uint64(4), scanner.totals.PrunedLinks.count)
+		assert.Equal(uint64(0), scanner.totals.Errors.count)
+
+		// The protected link is kept in place of the first
+		for _, name := range []string{"a/l1", "a/l3", "a/m1", "a/m2"} {
+			_, err := os.Lstat(name)
+			assert.True(os.IsNotExist(err), name)
+		}
+
+		// Pruned links are journaled, and restored by undo
+		entries, err := readJournal(journalPath)
+		assert.NoError(err)
+		assert.Len(journalActions(entries), 4)
+		assert.Equal(0, undo([]string{journalPath}))
+		for name, text := range map[string]string{"a/l1": "x", "a/l3": "./x", "a/m1": "missing", "a/m2": "missing"} {
+			link, err := os.Readlink(name)
+			assert.NoError(err, name)
+			assert.Equal(text, link, name)
+			assert.NoError(os.Remove(name))
+		}
+
+		for _, name := range []string{"a/l2", "a/l4", "a/l5"} {
+			_, err := os.Lstat(name)
+			assert.NoError(err, name)
+			assert.NoError(os.Remove(name))
+		}
+		validate(l)
+	})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/josephvusich/fdf/report"
+)
+
+// symlinkRecord is a symlink found by --symlink-audit
+type symlinkRecord struct {
+	// Absolute path of the link itself
+	FilePath string
+	RelPath  string
+
+	// Raw link text, as returned by os.Readlink
+	Text string
+
+	// Fully resolved target, or empty if the link is broken
+	Target string
+
+	protect *bool
+}
+
+func (l *symlinkRecord) Protect(o *options) bool {
+	if l.protect == nil {
+		ok := o.Protect.Includes(l.FilePath)
+		l.protect = &ok
+	}
+	return *l.protect
+}
+
+// symlinkAudit groups the symlinks walked by --symlink-audit
+type symlinkAudit struct {
+	byTarget    map[string][]*symlinkRecord
+	targetOrder []string
+
+	byText    map[string][]*symlinkRecord
+	textOrder []string
+
+	broken []*symlinkRecord
+}
+
+func newSymlinkAudit() *symlinkAudit {
+	return &symlinkAudit{
+		byTarget: make(map[string][]*symlinkRecord),
+		byText:   make(map[string][]*symlinkRecord),
+	}
+}
+
+// add records the symlink at path, which must not be excluded
+func (a *symlinkAudit) add(t *fileTable, path string) error {
+	text, err := os.Readlink(path)
+	if err != nil {
+		return err
+	}
+	l := &symlinkRecord{
+		FilePath: path,
+		RelPath:  t.Rel(path),
+		Text:     text,
+	}
+
+	// Only a missing or looping target makes a link broken. Other errors,
+	// such as a target that cannot be accessed, leave the link unaudited.
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) && !errors.Is(err, syscall.ELOOP) {
+		return err
+	}
+
+	if _, ok := a.byText[text]; !ok {
+		a.textOrder = append(a.textOrder, text)
+	}
+	a.byText[text] = append(a.byText[text], l)
+
+	if err != nil {
+		a.broken = append(a.broken, l)
+		return nil
+	}
+
+	l.Target = target
+
+	if _, ok := a.byTarget[l.Target]; !ok {
+		a.targetOrder = append(a.targetOrder, l.Target)
+	}
+	a.byTarget[l.Target] = append(a.byTarget[l.Target], l)
+	return nil
+}
+
+// redundant returns the links to target other than the one kept. The first
+// protected link is kept if there is one, otherwise the first link walked.
+func (a *symlinkAudit) redundant(o *options, target string) (kept *symlinkRecord, redundant []*symlinkRecord) {
+	links := a.byTarget[target]
+	kept = links[0]
+	for _, l := range links {
+		if l.Protect(o) {
+			kept = l
+			break
+		}
+	}
+	for _, l := range links {
+		if l != kept {
+			redundant = append(redundant, l)
+		}
+	}
+	return kept, redundant
+}
+
+// auditSymlinks reports redundant and broken symlinks, and deletes them for --prune-symlinks
+func (f *scanner) auditSymlinks() {
+	for _, target := range f.audit.targetOrder {
+		kept, redundant := f.audit.redundant(&f.options, target)
+		for _, l := range redundant {
+			f.totals.RedundantLinks.Add(nil)
+			fmt.Printf("%s -> %s == %s\n", kept.RelPath, f.table.Rel(target), l.RelPath)
+			f.pruneSymlink(l, kept)
+		}
+	}
+
+	for _, l := range f.audit.broken {
+		f.totals.BrokenLinks.Add(nil)
+		fmt.Printf("%s -> %s broken\n", l.RelPath, l.Text)
+		f.pruneSymlink(l, nil)
+	}
+}
+
+// pruneSymlink deletes l for --prune-symlinks. kept is the link retained
+// in place of l, or nil if l is broken.
+func (f *scanner) pruneSymlink(l, kept *symlinkRecord) {
+	if !f.options.PruneSymlinks {
+		return
+	}
+	if l.Protect(&f.options) {
+		if f.options.Verbose {
+			fmt.Printf("  skip( %s ) protected\n", l.RelPath)
+		}
+		return
+	}
+
+	fmt.Printf("  delete( %s )", l.RelPath)
+	if f.options.DryRun {
+		fmt.Printf(" %s\n", noErrDryRun)
+		return
+	}
+
+	f.Mutex.Destructive.RLock()
+	defer f.Mutex.Destructive.RUnlock()
+
+	// Never delete anything but the link itself, even if it was replaced since the walk
+	st, err := os.Lstat(l.FilePath)
+	if err == nil && st.Mode()&os.ModeSymlink == 0 {
+		err = fmt.Errorf("%s is no longer a symlink", l.RelPath)
+	}
+	var e *journalEntry
+	if err == nil && f.journal != nil {
+		e = &journalEntry{
+			Time:     time.Now(),
+			Verb:     JournalPrune,
+			Replaced: l.FilePath,
+			Link:     l.Text,
+		}
+		if kept != nil {
+			e.Kept = kept.FilePath
+		}
+		err = f.intend(e, "")
+	}
+	if err == nil {
+		err = os.Remove(l.FilePath)
+		if e != nil {
+			if jerr := f.journal.complete(e, "", err); jerr != nil && err == nil {
+				err = fmt.Errorf("unable to write journal: %w", jerr)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Printf(" %s\n", err)
+		f.totals.Errors.Add(nil)
+		return
+	}
+	fmt.Printf(" success\n")
+	f.totals.PrunedLinks.Add(nil)
+}
+
+// Report returns the groups of symlinks sharing a target or link text, along with broken links
+func (a *symlinkAudit) Report() *report.Symlinks {
+	r := &report.Symlinks{
+		SameTarget: [][]string{},
+		SameText:   [][]string{},
+		Broken:     []string{},
+	}
+	for _, target := range a.targetOrder {
+		if links := a.byTarget[target]; len(links) > 1 {
+			r.SameTarget = append(r.SameTarget, symlinkPaths(target, links))
+		}
+	}
+	for _, text := range a.textOrder {
+		if links := a.byText[text]; len(links) > 1 {
+			r.SameText = append(r.SameText, symlinkPaths(text, links))
+		}
+	}
+	for _, l := range a.broken {
+		r.Broken = append(r.Broken, l.FilePath)
+	}
+	return r
+}
+
+// symlinkPaths returns key followed by the path of each link
+func symlinkPaths(key string, links []*symlinkRecord) []string {
+	paths := []string{key}
+	for _, l := range links {
+		paths = append(paths, l.FilePath)
+	}
+	return paths
+}
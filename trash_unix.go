@@ -0,0 +1,216 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const trashSupported = true
+
+// trash moves files into the FreeDesktop.org trash, see
+// https://specifications.freedesktop.org/trash-spec/trashspec-latest.html
+type trash struct {
+	mutex sync.Mutex
+
+	// Trash directory for each device, nil if none is usable
+	dirs map[uint64]*trashDir
+}
+
+type trashDir struct {
+	// Contains the files and info subdirectories
+	path string
+
+	// Mount point for per-mount trash directories, whose .trashinfo paths
+	// are relative. Empty for the home trash.
+	topdir string
+}
+
+func newTrash() *trash {
+	return &trash{
+		dirs: make(map[uint64]*trashDir),
+	}
+}
+
+// put moves path into the trash directory of its mount, returning its new path.
+// Fails if no usable trash directory exists there. intend is called with the
+// new path before path is moved, and put fails without moving if intend fails.
+func (t *trash) put(path string, intend func(dst string) error) (string, error) {
+	st, err := os.Lstat(path)
+	if err != nil {
+		return "", err
+	}
+	s, ok := getStatInfo(st)
+	if !ok {
+		return "", errors.New("unable to determine device")
+	}
+
+	d := t.dir(s.Dev, path)
+	if d == nil {
+		return "", errors.New("no usable trash directory on this filesystem")
+	}
+
+	name, info, err := d.reserve(path)
+	if err != nil {
+		return "", err
+	}
+
+	dst := filepath.Join(d.path, "files", name)
+	if err = intend(dst); err != nil {
+		os.Remove(info)
+		return "", err
+	}
+	if err = os.Rename(path, dst); err != nil {
+		os.Remove(info)
+		return "", err
+	}
+	return dst, nil
+}
+
+// restoreTrash moves a file previously returned by put back to path,
+// removing its .trashinfo file
+func restoreTrash(trashed, path string) error {
+	if err := os.Rename(trashed, path); err != nil {
+		return err
+	}
+	info := filepath.Join(filepath.Dir(filepath.Dir(trashed)), "info", filepath.Base(trashed)+".trashinfo")
+	return os.Remove(info)
+}
+
+func (t *trash) dir(dev uint64, path string) *trashDir {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	d, ok := t.dirs[dev]
+	if !ok {
+		d = findTrashDir(dev, path)
+		t.dirs[dev] = d
+	}
+	return d
+}
+
+// findTrashDir returns the home trash if it resides on dev,
+// otherwise the per-mount trash of the mount containing path
+func findTrashDir(dev uint64, path string) *trashDir {
+	if home := homeTrashPath(); home != "" {
+		if d := (&trashDir{path: home}); d.usable(dev) {
+			return d
+		}
+	}
+
+	topdir := mountPoint(dev, path)
+	if topdir == "" {
+		return nil
+	}
+	uid := strconv.Itoa(os.Getuid())
+
+	// An administrator-created $topdir/.Trash must have the sticky bit set and not be a symlink
+	shared := filepath.Join(topdir, ".Trash")
+	if st, err := os.Lstat(shared); err == nil && st.IsDir() && st.Mode()&os.ModeSticky != 0 {
+		if d := (&trashDir{path: filepath.Join(shared, uid), topdir: topdir}); d.usable(dev) {
+			return d
+		}
+	}
+
+	if d := (&trashDir{path: filepath.Join(topdir, ".Trash-"+uid), topdir: topdir}); d.usable(dev) {
+		return d
+	}
+	return nil
+}
+
+func homeTrashPath() string {
+	if dataHome := os.Getenv("XDG_DATA_HOME"); dataHome != "" {
+		return filepath.Join(dataHome, "Trash")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "share", "Trash")
+	}
+	return ""
+}
+
+// usable creates the files and info subdirectories of d if necessary,
+// and returns true if d is a real directory on dev
+func (d *trashDir) usable(dev uint64) bool {
+	for _, sub := range []string{"files", "info"} {
+		if err := os.MkdirAll(filepath.Join(d.path, sub), 0700); err != nil {
+			return false
+		}
+	}
+
+	st, err := os.Lstat(d.path)
+	if err != nil || !st.IsDir() {
+		return false
+	}
+	s, ok := getStatInfo(st)
+	return ok && s.Dev == dev
+}
+
+// mountPoint returns the topmost ancestor of path that resides on dev
+func mountPoint(dev uint64, path string) string {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return ""
+	}
+
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		st, err := os.Stat(parent)
+		if err != nil {
+			return dir
+		}
+		if s, ok := getStatInfo(st); !ok || s.Dev != dev {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// reserve creates the .trashinfo file for path under an unused name, see reserveName
+func (d *trashDir) reserve(path string) (name, info string, err error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+
+	stored := abs
+	if d.topdir != "" {
+		if stored, err = filepath.Rel(d.topdir, abs); err != nil {
+			return "", "", err
+		}
+	}
+
+	contents := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: stored}).EscapedPath(),
+		time.Now().Format("2006-01-02T15:04:05"))
+
+	name, err = reserveName(filepath.Base(abs), func(name string) error {
+		info = filepath.Join(d.path, "info", name+".trashinfo")
+		f, err := os.OpenFile(info, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		_, err = f.WriteString(contents)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(info)
+		}
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return name, info, nil
+}
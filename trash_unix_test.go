@@ -0,0 +1,77 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanner_Trash(t *testing.T) {
+	assert := require.New(t)
+
+	dataHome, err := ioutil.TempDir("", "fdftrash")
+	assert.NoError(err)
+	defer os.RemoveAll(dataHome)
+
+	prev, hadPrev := os.LookupEnv("XDG_DATA_HOME")
+	assert.NoError(os.Setenv("XDG_DATA_HOME", dataHome))
+	defer func() {
+		if hadPrev {
+			os.Setenv("XDG_DATA_HOME", prev)
+		} else {
+			os.Unsetenv("XDG_DATA_HOME")
+		}
+	}()
+
+	setupTest(assert, func(l *testLayout, validate func(*testLayout)) {
+		// Collides with the first trashed bar
+		trashDir := filepath.Join(dataHome, "Trash")
+		assert.NoError(os.MkdirAll(filepath.Join(trashDir, "info"), 0700))
+		assert.NoError(ioutil.WriteFile(filepath.Join(trashDir, "info", "bar2.trashinfo"), nil, 0600))
+
+		scanner := newScanner()
+		assert.Empty(scanner.options.ParseArgs([]string{`fdf`, `-r`, `-z`, `0`, `--timestamps`, `ignore`, `--delete`, `--trash`}))
+
+		assert.NoError(scanner.Scan())
+		assert.Equal(uint64(15), scanner.totals.Processed.count)
+		assert.Equal(uint64(40), scanner.totals.Processed.size)
+		assert.Equal(uint64(0), scanner.totals.Errors.count)
+
+		files, err := ioutil.ReadDir(filepath.Join(trashDir, "files"))
+		assert.NoError(err)
+		assert.Len(files, 15)
+
+		for _, f := range files {
+			b, err := ioutil.ReadFile(filepath.Join(trashDir, "info", f.Name()+".trashinfo"))
+			assert.NoError(err)
+			lines := strings.Split(string(b), "\n")
+			assert.Equal("[Trash Info]", lines[0])
+			assert.True(strings.HasPrefix(lines[1], "Path=/"), lines[1])
+			assert.True(strings.HasPrefix(lines[2], "DeletionDate="), lines[2])
+
+			_, err = os.Stat(strings.TrimPrefix(lines[1], "Path="))
+			assert.True(os.IsNotExist(err), lines[1])
+		}
+		_, err = os.Stat(filepath.Join(trashDir, "files", "bar2 (1)"))
+		assert.NoError(err)
+
+		l.contentOverride = true
+		l.content = map[string]string{
+			"a/bar":         "bar\n",
+			"a/diffContent": "fizz\n",
+			"a/diffSize":    "foobar\n",
+			"a/empty":       "",
+			"a/foo":         "foo\n",
+			"b/diffContent": "buzz\n",
+			"b/diffSize":    "foobar2\n",
+		}
+		validate(l)
+	})
+}
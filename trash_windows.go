@@ -0,0 +1,19 @@
+package main
+
+import "errors"
+
+const trashSupported = false
+
+type trash struct{}
+
+func newTrash() *trash {
+	return &trash{}
+}
+
+func (t *trash) put(path string, intend func(dst string) error) (string, error) {
+	return "", errors.New("--trash is not supported on Windows")
+}
+
+func restoreTrash(trashed, path string) error {
+	return errors.New("--trash is not supported on Windows")
+}
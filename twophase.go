@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+)
+
+// pendingFile is a file held back by --two-phase until every directory has been walked
+type pendingFile struct {
+	path       string
+	pathSuffix string
+	info       os.FileInfo
+
+	// fileTable state at the time the file was walked
+	scanDir    string
+	relDir     string
+	viaSymlink bool
+}
+
+// enqueue buckets a walked file by its candidate query. Files that cannot
+// be bucketed are processed immediately, as they would be without --two-phase.
+func (f *scanner) enqueue(path, pathSuffix string, info os.FileInfo) {
+	if info.IsDir() {
+		return
+	}
+
+	if f.options.Exclude.Includes(path) || f.options.filtered(info) {
+		f.process(path, pathSuffix)
+		return
+	}
+
+	r := newFileRecord(path, info, "", pathSuffix)
+	q := *f.table.candidateQuery(r)
+
+	if f.pending == nil {
+		f.pending = make(map[query][]*pendingFile)
+	}
+	bucket, ok := f.pending[q]
+	if !ok {
+		f.pendingOrder = append(f.pendingOrder, q)
+	}
+	f.pending[q] = append(bucket, &pendingFile{
+		path:       path,
+		pathSuffix: pathSuffix,
+		info:       info,
+		scanDir:    f.table.scanDir,
+		relDir:     f.table.relDir,
+		viaSymlink: f.table.viaSymlink,
+	})
+}
+
+// processPending runs the second phase of --two-phase. Buckets with a single
+// file are counted as unique without being opened. With --jobs, the files of
+// each bucket are hashed concurrently before any of them are compared.
+func (f *scanner) processPending() {
+	for _, q := range f.pendingOrder {
+		bucket := f.pending[q]
+		if len(bucket) == 1 {
+			r := newFileRecord(bucket[0].path, bucket[0].info, "", bucket[0].pathSuffix)
+			f.totals.Files.Add(r)
+			f.totals.Unique.Add(r)
+			continue
+		}
+
+		f.hashAhead(bucket)
+		for _, p := range bucket {
+			f.table.scanDir, f.table.relDir, f.table.viaSymlink = p.scanDir, p.relDir, p.viaSymlink
+			f.table.progress(p.path, true)
+			f.process(p.path, p.pathSuffix)
+		}
+		f.table.hashed = nil
+	}
+
+	f.table.viaSymlink = false
+	f.pending = nil
+	f.pendingOrder = nil
+}
+
+// hashAhead hashes the files of bucket concurrently if --jobs allows, and
+// leaves the results in fileTable.hashed for findStat
+func (f *scanner) hashAhead(bucket []*pendingFile) {
+	if f.options.Jobs <= 1 || !f.options.MatchMode.has(matchContent) || f.options.MatchMode.has(matchHardlink) {
+		return
+	}
+
+	records := make([]*fileRecord, len(bucket))
+	f.table.hashed = make(map[string]*fileRecord, len(bucket))
+	for i, p := range bucket {
+		f.table.scanDir, f.table.relDir = p.scanDir, p.relDir
+		records[i] = newFileRecord(p.path, p.info, f.table.Rel(p.path), p.pathSuffix)
+		f.table.hashed[p.path] = records[i]
+	}
+	f.table.hashAhead(records)
+}
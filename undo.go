@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/josephvusich/go-getopt"
+)
+
+// undo reverses the actions recorded in a --journal file, most recent first,
+// and returns the process exit code
+func undo(args []string) int {
+	fs := getopt.NewFlagSet("fdf undo", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, "usage: fdf undo [--dry-run] JOURNAL\n\n")
+		fs.PrintDefaults()
+	}
+	dryRun := fs.Bool("dry-run", false, "don't actually do anything, just show what would be done")
+	helpFlag := fs.Bool("help", false, "show this help screen and exit")
+	fs.Alias("h", "help")
+
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if *helpFlag {
+		fs.Usage()
+		return 0
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 1
+	}
+
+	entries, err := readJournal(fs.Arg(0))
+	if err != nil {
+		fmt.Printf("%s: %s\n", fs.Arg(0), err)
+		return 1
+	}
+	entries = journalActions(entries)
+
+	var reversed, failed int
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		fmt.Printf("  undo-%s( %s )", e.Verb, e.Replaced)
+		if e.Status == JournalPending {
+			fmt.Printf(" interrupted,")
+		}
+		if *dryRun {
+			fmt.Printf(" skipped\n")
+			continue
+		}
+		if err := e.undo(); err != nil {
+			fmt.Printf(" %s\n", err)
+			failed++
+			continue
+		}
+		fmt.Printf(" success\n")
+		reversed++
+	}
+
+	fmt.Printf("\n%d of %d actions reversed\n", reversed, len(entries))
+	if failed != 0 {
+		fmt.Printf("%d actions could not be reversed\n", failed)
+		return 1
+	}
+	return 0
+}
+
+func readJournal(path string) (entries []*journalEntry, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	for dec.More() {
+		e := &journalEntry{}
+		if err = dec.Decode(e); err != nil {
+			return nil, fmt.Errorf("entry %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// journalActions merges the outcome of each action into the entry recorded
+// as pending before it was taken. Actions that failed are omitted, while
+// actions that were interrupted remain pending.
+func journalActions(entries []*journalEntry) (actions []*journalEntry) {
+	pending := map[string]*journalEntry{}
+	for _, e := range entries {
+		if p, ok := pending[e.Replaced]; ok && e.Status != JournalPending {
+			delete(pending, e.Replaced)
+			p.Status = e.Status
+			if e.Moved != "" {
+				p.Moved = e.Moved
+			}
+			continue
+		}
+		if e.Status == JournalPending {
+			pending[e.Replaced] = e
+		}
+		actions = append(actions, e)
+	}
+
+	n := 0
+	for _, e := range actions {
+		if e.Status != JournalFailed {
+			actions[n] = e
+			n++
+		}
+	}
+	return actions[:n]
+}
+
+func (e *journalEntry) undo() error {
+	switch e.Verb {
+	case JournalLink:
+		kept, err := os.Stat(e.Kept)
+		if err != nil {
+			return err
+		}
+		replaced, err := os.Stat(e.Replaced)
+		if err != nil {
+			return err
+		}
+		if !os.SameFile(kept, replaced) {
+			return errors.New("no longer hardlinked to " + e.Kept)
+		}
+		return e.split()
+	case JournalClone, JournalDedupe:
+		return e.split()
+	case JournalSymlink:
+		st, err := os.Lstat(e.Replaced)
+		if err != nil {
+			return err
+		}
+		if st.Mode()&os.ModeSymlink == 0 {
+			return errors.New("no longer a symlink")
+		}
+		return e.split()
+	case JournalCopy:
+		return e.relink()
+	case JournalMove:
+		return e.restore(func(src, dst string) error {
+			if err := os.Rename(src, dst); !errors.Is(err, syscall.EXDEV) {
+				return err
+			}
+			return moveAcrossDevices(src, dst)
+		})
+	case JournalTrash:
+		return e.restore(restoreTrash)
+	case JournalPrune:
+		if _, err := os.Lstat(e.Replaced); err == nil {
+			return errors.New("original path already exists")
+		}
+		return os.Symlink(e.Link, e.Replaced)
+	case JournalDelete:
+		return errors.New("deleted files cannot be restored")
+	}
+	return fmt.Errorf("unknown action %q", e.Verb)
+}
+
+// split replaces a link or clone with an independent copy of its contents,
+// restoring its original metadata
+func (e *journalEntry) split() error {
+	if err := e.verify(e.Replaced); err != nil {
+		return err
+	}
+
+	tmp, err := tempName(e.Replaced)
+	if err != nil {
+		return err
+	}
+	if err = copyIndependent(e.Replaced, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = e.metadata().apply(tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, e.Replaced)
+}
+
+// relink restores a hardlink split by --copy. Files copied by --copy-unlinked
+// were never hardlinked, and are left alone.
+func (e *journalEntry) relink() error {
+	st, err := os.Stat(e.Kept)
+	if err != nil {
+		return err
+	}
+	if s, ok := getStatInfo(st); !ok || e.Ino == 0 {
+		return errors.New("unable to verify that the files were hardlinked")
+	} else if s.Dev != e.Dev || s.Ino != e.Ino {
+		return errors.New("was not hardlinked to " + e.Kept)
+	}
+
+	// Both files must be unchanged, or edits made to either since would be lost
+	if err := e.verify(e.Kept); err != nil {
+		return err
+	}
+	if err := e.verify(e.Replaced); err != nil {
+		return err
+	}
+
+	tmp, err := tempName(e.Replaced)
+	if err != nil {
+		return err
+	}
+	if err = os.Link(e.Kept, tmp); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, e.Replaced); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// restore returns a moved file to its original path using move
+func (e *journalEntry) restore(move func(src, dst string) error) error {
+	if e.Moved == "" {
+		return errors.New("new path was not recorded")
+	}
+	if _, err := os.Lstat(e.Replaced); err == nil {
+		return errors.New("original path already exists")
+	}
+	if err := os.MkdirAll(filepath.Dir(e.Replaced), 0777); err != nil {
+		return err
+	}
+	return move(e.Moved, e.Replaced)
+}
+
+// verify returns an error if the contents of path no longer match the journal.
+// Checksums that depend on the random key of a previous run are not verified.
+func (e *journalEntry) verify(path string) error {
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if st.Size() != e.Size {
+		return fmt.Errorf("size of %s has changed", path)
+	}
+
+	a, ok := hashAlgorithms[e.Hash]
+	if e.Checksum == "" || !ok || a.keyed {
+		return nil
+	}
+
+	h, err := a.new()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sum, err := sumReader(h, f)
+	if err != nil {
+		return err
+	}
+	var c checksum
+	copy(c.hash[:], sum)
+	if checksumHex(e.Hash, c) != e.Checksum {
+		return fmt.Errorf("contents of %s have changed", path)
+	}
+	return nil
+}
+
+func (e *journalEntry) metadata() *fileMetadata {
+	return &fileMetadata{
+		Mode:     e.Mode,
+		HasOwner: e.HasOwner,
+		Uid:      e.Uid,
+		Gid:      e.Gid,
+		Atime:    e.Atime,
+		Mtime:    e.Mtime,
+		Xattrs:   e.Xattrs,
+	}
+}
+
+// copyIndependent copies src to dst with read and write, so that dst
+// cannot share extents with src even where copy_file_range would reflink
+func copyIndependent(src, dst string) error {
+	sf, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	df, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer df.Close()
+
+	// Hide ReadFrom and WriteTo to prevent io.Copy from using copy_file_range
+	w := struct{ io.Writer }{df}
+	r := struct{ io.Reader }{sf}
+	if _, err = io.CopyBuffer(w, r, make([]byte, fileBufferSize)); err != nil {
+		return err
+	}
+	return df.Close()
+}